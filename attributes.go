@@ -0,0 +1,179 @@
+package ocaws
+
+import (
+	"bytes"
+	"strconv"
+
+	"go.krak3n.codes/ocaws/propagation"
+	"go.opencensus.io/trace"
+)
+
+// A MessageAttributeValue is a message attribute value independent of the AWS
+// service the message is sent with
+type MessageAttributeValue struct {
+	DataType    string
+	StringValue *string
+	BinaryValue []byte
+}
+
+// MessageAttributes carries message attributes independently of the AWS
+// service, SQS and SNS each have their own message attribute types so convert
+// to and from these to apply span contexts the same way for both services
+type MessageAttributes map[string]MessageAttributeValue
+
+// StringAttribute returns a String message attribute value
+func StringAttribute(v string) MessageAttributeValue {
+	return MessageAttributeValue{
+		DataType:    "String",
+		StringValue: &v,
+	}
+}
+
+// NumberAttribute returns a Number message attribute value
+func NumberAttribute(v int64) MessageAttributeValue {
+	s := strconv.FormatInt(v, 10)
+
+	return MessageAttributeValue{
+		DataType:    "Number",
+		StringValue: &s,
+	}
+}
+
+// Copy returns a copy of the message attributes, nil is returned if the
+// attributes are nil
+func (a MessageAttributes) Copy() MessageAttributes {
+	if a == nil {
+		return nil
+	}
+
+	dst := make(MessageAttributes, len(a))
+	dst.Merge(a)
+
+	return dst
+}
+
+// Merge copies the message attributes from the sources into a
+func (a MessageAttributes) Merge(srcs ...MessageAttributes) {
+	for _, src := range srcs {
+		for k, v := range src {
+			a[k] = v
+		}
+	}
+}
+
+// Changed returns the message attributes of a which are not in prev or whose
+// values differ from prev, these are the attributes added by propagating a
+// span context or offloading a message body
+func (a MessageAttributes) Changed(prev MessageAttributes) MessageAttributes {
+	changed := make(MessageAttributes)
+	for k, v := range a {
+		if pv, ok := prev[k]; ok && pv.equal(v) {
+			continue
+		}
+
+		changed[k] = v
+	}
+
+	return changed
+}
+
+// equal returns true if the message attribute values are the same
+func (v MessageAttributeValue) equal(o MessageAttributeValue) bool {
+	if v.DataType != o.DataType || !bytes.Equal(v.BinaryValue, o.BinaryValue) {
+		return false
+	}
+
+	if v.StringValue == nil || o.StringValue == nil {
+		return v.StringValue == o.StringValue
+	}
+
+	return *v.StringValue == *o.StringValue
+}
+
+// Fits returns true if the message attributes in src can be merged into a
+// without exceeding MaxMessageAttributes
+func (a MessageAttributes) Fits(src MessageAttributes) bool {
+	n := len(a)
+	for k := range src {
+		if _, ok := a[k]; !ok {
+			n++
+		}
+	}
+
+	return n <= MaxMessageAttributes
+}
+
+// A Propagation applies span contexts to message attributes within the
+// message attribute limit
+type Propagation struct {
+	// Propagators are tried in order until the span context attributes of
+	// one fit within the message attribute limit
+	Propagators []propagation.Propagator
+
+	// Inject applies the span context to new message attributes using the
+	// propagator, converting from the message attribute type of the service
+	Inject func(propagation.Propagator, trace.SpanContext) (MessageAttributes, bool)
+
+	// Extras are added once the span context has been applied in order of
+	// priority, each is only added if those before it were added
+	Extras []MessageAttributes
+
+	// CountAttribute is the span attribute key the number of message
+	// attributes is annotated with
+	CountAttribute string
+}
+
+// Propagate returns a copy of the message attributes with the span context
+// applied by the first propagator whose attributes fit along with the index
+// of the propagator, -1 is returned if no propagator fits
+func (p *Propagation) Propagate(sc trace.SpanContext, attrs MessageAttributes) (MessageAttributes, int) {
+	attrs = attrs.Copy()
+	if attrs == nil {
+		attrs = make(MessageAttributes)
+	}
+
+	for i, pr := range p.Propagators {
+		if pr == nil {
+			continue
+		}
+
+		scattrs, ok := p.Inject(pr, sc)
+		if !ok || !attrs.Fits(scattrs) {
+			continue
+		}
+
+		attrs.Merge(scattrs)
+
+		for _, extra := range p.Extras {
+			if !attrs.Fits(extra) {
+				break
+			}
+
+			attrs.Merge(extra)
+		}
+
+		return attrs, i
+	}
+
+	return attrs, -1
+}
+
+// Apply returns a copy of the message attributes with the span context of the
+// span applied, the span is annotated if the span context was propagated by a
+// fallback propagator or could not be propagated
+func (p *Propagation) Apply(span *trace.Span, attrs MessageAttributes) MessageAttributes {
+	attrs, i := p.Propagate(span.SpanContext(), attrs)
+
+	switch {
+	case i < 0:
+		span.Annotate([]trace.Attribute{
+			trace.Int64Attribute(p.CountAttribute, int64(len(attrs))),
+		}, "Span context not propagated: message attribute limit reached")
+	case i > 0:
+		span.Annotate([]trace.Attribute{
+			trace.Int64Attribute(p.CountAttribute, int64(len(attrs))),
+		}, "Span context propagated by fallback propagator: message attribute limit reached")
+	}
+
+	return attrs
+}
@@ -0,0 +1,146 @@
+package ocaws
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.krak3n.codes/ocaws/propagation"
+	"go.opencensus.io/trace"
+)
+
+// keysPropagator propagates span context as one message attribute per key
+type keysPropagator []string
+
+func (p keysPropagator) SpanContextToMessageAttributes(sc trace.SpanContext, v interface{}) bool {
+	return len(p) > 0
+}
+
+func (p keysPropagator) SpanContextFromMessageAttributes(v interface{}) (trace.SpanContext, bool) {
+	return trace.SpanContext{}, false
+}
+
+func injectKeys(p propagation.Propagator, sc trace.SpanContext) (MessageAttributes, bool) {
+	keys := p.(keysPropagator)
+	if ok := keys.SpanContextToMessageAttributes(sc, nil); !ok {
+		return nil, false
+	}
+
+	attrs := make(MessageAttributes, len(keys))
+	for _, k := range keys {
+		attrs[k] = StringAttribute(sc.TraceID.String())
+	}
+
+	return attrs, true
+}
+
+func TestMessageAttributes_Copy(t *testing.T) {
+	var nilAttrs MessageAttributes
+	assert.Nil(t, nilAttrs.Copy())
+
+	attrs := MessageAttributes{"Foo": StringAttribute("foo")}
+
+	cp := attrs.Copy()
+	cp["Bar"] = StringAttribute("bar")
+
+	assert.Equal(t, MessageAttributes{"Foo": StringAttribute("foo")}, attrs)
+}
+
+func TestMessageAttributes_Changed(t *testing.T) {
+	prev := MessageAttributes{
+		"Foo": StringAttribute("foo"),
+		"Bar": StringAttribute("bar"),
+	}
+
+	attrs := MessageAttributes{
+		"Foo": StringAttribute("foo"),
+		"Bar": StringAttribute("baz"),
+		"Baz": NumberAttribute(1),
+	}
+
+	assert.Equal(t, MessageAttributes{
+		"Bar": StringAttribute("baz"),
+		"Baz": NumberAttribute(1),
+	}, attrs.Changed(prev))
+}
+
+func TestPropagation_Apply(t *testing.T) {
+	attrs := func(n int) MessageAttributes {
+		attrs := make(MessageAttributes, n)
+		for i := 0; i < n; i++ {
+			attrs[fmt.Sprintf("Attr%d", i)] = StringAttribute("foo")
+		}
+
+		return attrs
+	}
+
+	type TestCase struct {
+		tName string
+		attrs MessageAttributes
+		keys  []string
+	}
+	tt := []TestCase{
+		{
+			tName: "nil attributes",
+			keys:  []string{"A", "B", "C", "Extra1", "Extra2"},
+		},
+		{
+			tName: "fits with extras",
+			attrs: attrs(5),
+			keys:  []string{"A", "B", "C", "Extra1", "Extra2"},
+		},
+		{
+			tName: "fits with first extra",
+			attrs: attrs(6),
+			keys:  []string{"A", "B", "C", "Extra1"},
+		},
+		{
+			tName: "fits without extras",
+			attrs: attrs(7),
+			keys:  []string{"A", "B", "C"},
+		},
+		{
+			tName: "fallback",
+			attrs: attrs(8),
+			keys:  []string{"D", "Extra1"},
+		},
+		{
+			tName: "skipped",
+			attrs: attrs(10),
+		},
+		{
+			tName: "existing keys",
+			attrs: MessageAttributes{"A": StringAttribute("foo")},
+			keys:  []string{"B", "C", "Extra1", "Extra2"},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			p := &Propagation{
+				Propagators: []propagation.Propagator{keysPropagator{"A", "B", "C"}, keysPropagator{"D"}},
+				Inject:      injectKeys,
+				Extras: []MessageAttributes{
+					{"Extra1": StringAttribute("foo")},
+					{"Extra2": StringAttribute("foo")},
+				},
+				CountAttribute: "message_attributes",
+			}
+
+			_, span := trace.StartSpan(context.Background(), t.Name(), trace.WithSampler(trace.AlwaysSample()))
+			defer span.End()
+
+			prev := tc.attrs.Copy()
+			attrs := p.Apply(span, tc.attrs)
+
+			assert.Equal(t, prev, tc.attrs, "attributes not copied")
+			assert.Len(t, attrs, len(tc.attrs)+len(tc.keys))
+			for _, k := range tc.keys {
+				assert.Contains(t, attrs, k)
+			}
+		})
+	}
+}
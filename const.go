@@ -4,4 +4,12 @@ package ocaws // import "go.krak3n.codes/ocaws"
 const (
 	TraceTopicName = "Trace-Topic-Name"
 	TraceQueueURL  = "Trace-Queue-Url"
+
+	// TraceSentTimestamp holds the time a message was published in
+	// milliseconds since the epoch
+	TraceSentTimestamp = "Trace-Sent-Timestamp"
 )
+
+// MaxMessageAttributes is the maximum number of message attributes SQS and SNS
+// allow on a single message
+const MaxMessageAttributes = 10
@@ -52,5 +52,17 @@ which will return you a span based on the messages span context message attribut
     }
 
 See more complete examples in the ocsns documentation: https://godoc.org/go.krak3n.codes/ocaws/ocsqs#pkg-examples
+
+
+Message Size
+
+SQS and SNS limit messages to 256 KB including message attributes, adding span
+context message attributes can push a message over this limit. The ocsqs and
+ocsns clients record the size of each message on the span and apply an
+OversizePolicy to messages which exceed MaxMessageSize. SendOversize sends the
+message as is, DropTraceAttributes removes the span context attributes and
+RejectOversize returns a *MessageTooLargeError without sending the message.
+
+    client := ocsqs.New(sqs.New(session), ocsqs.WithOversizePolicy(ocaws.DropTraceAttributes))
 */
 package ocaws // import "go.krak3n.codes/ocaws"
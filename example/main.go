@@ -47,14 +47,22 @@ func main() {
 
 	defer server.Shutdown(ctx)
 
-	client := NewClient(sqs)
+	consumerCtx, cancel := context.WithCancel(ctx)
+	doneC := make(chan struct{})
+
+	consumer := NewConsumer(sqs)
 	go func() {
-		if err := client.Consume(ctx, DefaultHandler); err != nil {
+		defer close(doneC)
+		if err := consumer.Consume(consumerCtx, DefaultHandler); err != nil {
 			errC <- err
 		}
 	}()
 
-	defer client.Stop()
+	// Stop receiving messages and wait for messages in flight to be handled
+	defer func() {
+		cancel()
+		<-doneC
+	}()
 
 	signal.Notify(sigC, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
 	select {
@@ -0,0 +1,36 @@
+package ocawstest
+
+import (
+	"sync"
+
+	"go.opencensus.io/trace"
+)
+
+// TestExporter implements the trace.Exporter interface storing exported spans
+// in memory so assertions can be made against them
+type TestExporter struct {
+	mtx   sync.Mutex
+	spans []*trace.SpanData
+}
+
+// ExportSpan stores the exported span
+func (e *TestExporter) ExportSpan(s *trace.SpanData) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	e.spans = append(e.spans, s)
+}
+
+// Span returns the last exported span with the given name
+func (e *TestExporter) Span(name string) (*trace.SpanData, bool) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+
+	for i := len(e.spans) - 1; i >= 0; i-- {
+		if e.spans[i].Name == name {
+			return e.spans[i], true
+		}
+	}
+
+	return nil, false
+}
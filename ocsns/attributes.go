@@ -0,0 +1,105 @@
+package ocsns
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"go.krak3n.codes/ocaws"
+	"go.krak3n.codes/ocaws/propagation"
+	"go.opencensus.io/trace"
+)
+
+// toCarrier converts SNS message attributes to ocaws.MessageAttributes
+func toCarrier(attrs map[string]*sns.MessageAttributeValue) ocaws.MessageAttributes {
+	if attrs == nil {
+		return nil
+	}
+
+	c := make(ocaws.MessageAttributes, len(attrs))
+	for k, v := range attrs {
+		if v == nil {
+			continue
+		}
+
+		c[k] = ocaws.MessageAttributeValue{
+			DataType:    aws.StringValue(v.DataType),
+			StringValue: v.StringValue,
+			BinaryValue: v.BinaryValue,
+		}
+	}
+
+	return c
+}
+
+// fromCarrier returns a copy of the SNS message attributes with the
+// attributes of c which were added or changed since prev, the carrier the
+// attributes were converted to by toCarrier. The values of the given message
+// attributes are copied as they are as the carrier does not hold every value.
+func fromCarrier(attrs map[string]*sns.MessageAttributeValue, prev, c ocaws.MessageAttributes) map[string]*sns.MessageAttributeValue {
+	if attrs == nil && c == nil {
+		return nil
+	}
+
+	dst := copyMessageAttributes(attrs)
+	if dst == nil {
+		dst = make(map[string]*sns.MessageAttributeValue, len(c))
+	}
+
+	for k, v := range c.Changed(prev) {
+		dst[k] = &sns.MessageAttributeValue{
+			DataType:    aws.String(v.DataType),
+			StringValue: v.StringValue,
+			BinaryValue: v.BinaryValue,
+		}
+	}
+
+	return dst
+}
+
+// copyMessageAttributes returns a shallow copy of the message attributes, nil
+// is returned if the attributes are nil
+func copyMessageAttributes(attrs map[string]*sns.MessageAttributeValue) map[string]*sns.MessageAttributeValue {
+	if attrs == nil {
+		return nil
+	}
+
+	dst := make(map[string]*sns.MessageAttributeValue, len(attrs))
+	for k, v := range attrs {
+		dst[k] = v
+	}
+
+	return dst
+}
+
+// injectMessageAttributes applies the span context to new SNS message
+// attributes using the propagator
+func injectMessageAttributes(p propagation.Propagator, sc trace.SpanContext) (ocaws.MessageAttributes, bool) {
+	attrs := make(map[string]*sns.MessageAttributeValue)
+	ok := p.SpanContextToMessageAttributes(sc, attrs)
+
+	return toCarrier(attrs), ok
+}
+
+// messagePropagation returns the propagation of span contexts to messages
+// published to the topic using the propagators, the topic name and then the
+// time the message was published are added if there is room
+func messagePropagation(topicARN *string, propagators []propagation.Propagator) *ocaws.Propagation {
+	p := &ocaws.Propagation{
+		Propagators:    propagators,
+		Inject:         injectMessageAttributes,
+		CountAttribute: MessageAttributesAttribute,
+	}
+
+	if topicARN != nil {
+		p.Extras = append(p.Extras, ocaws.MessageAttributes{
+			ocaws.TraceTopicName: ocaws.StringAttribute(topicNameFromARN(*topicARN)),
+		})
+	}
+
+	p.Extras = append(p.Extras, ocaws.MessageAttributes{
+		ocaws.TraceSentTimestamp: ocaws.NumberAttribute(time.Now().UnixNano() / int64(time.Millisecond)),
+	})
+
+	return p
+}
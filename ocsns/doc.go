@@ -3,5 +3,52 @@ providing methods for persisiting spans to SNS topics.
 
     client := ocsqs.New(sqs.New(session))
 
+
+Notifications
+
+Messages delivered to SQS queues from SNS without raw message delivery are
+wrapped in a notification envelope. Use DecodeNotification to unwrap the
+message body, topic and span context in a single parse:
+
+    n, err := ocsns.DecodeNotification([]byte(*msg.Body))
+    if err != nil {
+        return err
+    }
+
+    sc, ok := n.SpanContext(b3.New())
+
+Published messages carry the time they were published in the
+Trace-Sent-Timestamp message attribute, used by ocsqs to measure the end to end
+latency of messages delivered in notification envelopes.
+
+
+Message Size
+
+The size of each message is recorded on the span, use WithOversizePolicy to
+set the ocaws.OversizePolicy applied to messages larger than 256 KB:
+
+    client := ocsns.New(sns.New(session), ocsns.WithOversizePolicy(ocaws.DropTraceAttributes))
+
+
+Large Messages
+
+Messages which are too large can have their bodies stored in S3 using an
+offload.Offloader, a pointer to the object is published instead. The upload
+is a child span of the span in the context. Consumers configured with
+ocsqs.WithOffloader download the body for SQS subscriptions with or without
+raw message delivery, without it the pointer in the SNS envelope is replaced.
+
+    client := ocsns.New(sns.New(session), ocsns.WithOffloader(offload.New(s3.New(session), "bucket")))
+
+
+Stats
+
+The SNS client records OpenCensus stats for messages published and publish
+latency tagged by topic name and outcome. Register DefaultViews to export them:
+
+    if err := view.Register(ocsns.DefaultViews...); err != nil {
+        log.Fatal(err)
+    }
+
 */
 package ocsns // import "go.krak3n.codes/ocaws/ocsns"
@@ -0,0 +1,118 @@
+package ocsns
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"go.krak3n.codes/ocaws/propagation"
+	"go.opencensus.io/trace"
+)
+
+// A Notification is the envelope SNS wraps messages in when delivering them to
+// subscriptions without raw message delivery enabled, such as SQS queues.
+type Notification struct {
+	Type              string
+	MessageID         string
+	TopicArn          string
+	Subject           string
+	Message           string
+	Timestamp         time.Time
+	SignatureVersion  string
+	Signature         string
+	SigningCertURL    string
+	UnsubscribeURL    string
+	MessageAttributes map[string]*sns.MessageAttributeValue
+}
+
+// notification is the JSON representation of a Notification
+type notification struct {
+	Type              string                           `json:"Type"`
+	MessageID         string                           `json:"MessageId"`
+	TopicArn          string                           `json:"TopicArn"`
+	Subject           string                           `json:"Subject"`
+	Message           string                           `json:"Message"`
+	Timestamp         time.Time                        `json:"Timestamp"`
+	SignatureVersion  string                           `json:"SignatureVersion"`
+	Signature         string                           `json:"Signature"`
+	SigningCertURL    string                           `json:"SigningCertURL"`
+	UnsubscribeURL    string                           `json:"UnsubscribeURL"`
+	MessageAttributes map[string]notificationAttribute `json:"MessageAttributes"`
+}
+
+// notificationAttribute is the JSON representation of a message attribute
+// within a Notification, binary values are base64 encoded
+type notificationAttribute struct {
+	Type  string `json:"Type"`
+	Value string `json:"Value"`
+}
+
+// DecodeNotification decodes an SNS notification envelope, typically the body
+// of an SQS message delivered from an SNS topic.
+func DecodeNotification(b []byte) (*Notification, error) {
+	n := &Notification{}
+	if err := json.Unmarshal(b, n); err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface decoding message
+// attributes according to their type
+func (n *Notification) UnmarshalJSON(b []byte) error {
+	var dst notification
+	if err := json.Unmarshal(b, &dst); err != nil {
+		return err
+	}
+
+	*n = Notification{
+		Type:             dst.Type,
+		MessageID:        dst.MessageID,
+		TopicArn:         dst.TopicArn,
+		Subject:          dst.Subject,
+		Message:          dst.Message,
+		Timestamp:        dst.Timestamp,
+		SignatureVersion: dst.SignatureVersion,
+		Signature:        dst.Signature,
+		SigningCertURL:   dst.SigningCertURL,
+		UnsubscribeURL:   dst.UnsubscribeURL,
+	}
+
+	if dst.MessageAttributes == nil {
+		return nil
+	}
+
+	n.MessageAttributes = make(map[string]*sns.MessageAttributeValue, len(dst.MessageAttributes))
+
+	for k, v := range dst.MessageAttributes {
+		attr := &sns.MessageAttributeValue{
+			DataType: aws.String(v.Type),
+		}
+
+		// Data types can have custom suffixes, e.g Binary.gif
+		if strings.HasPrefix(v.Type, "Binary") {
+			value, err := base64.StdEncoding.DecodeString(v.Value)
+			if err != nil {
+				return err
+			}
+
+			attr.BinaryValue = value
+		} else {
+			attr.StringValue = aws.String(v.Value)
+		}
+
+		n.MessageAttributes[k] = attr
+	}
+
+	return nil
+}
+
+// SpanContext returns the span context propagated on the notification message
+// attributes using the given propagator
+func (n *Notification) SpanContext(p propagation.Propagator) (trace.SpanContext, bool) {
+	return p.SpanContextFromMessageAttributes(n.MessageAttributes)
+}
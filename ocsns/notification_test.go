@@ -0,0 +1,111 @@
+package ocsns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/stretchr/testify/assert"
+	"go.krak3n.codes/ocaws/ocawstest"
+	"go.krak3n.codes/ocaws/propagation/b3"
+)
+
+func TestDecodeNotification(t *testing.T) {
+	type TestCase struct {
+		tName        string
+		body         string
+		notification *Notification
+		err          bool
+	}
+	tt := []TestCase{
+		{
+			tName: "invalid json",
+			body:  `foo`,
+			err:   true,
+		},
+		{
+			tName: "invalid binary attribute",
+			body:  `{"MessageAttributes":{"Foo":{"Type":"Binary","Value":"!"}}}`,
+			err:   true,
+		},
+		{
+			tName:        "no message attributes",
+			body:         `{"Type":"Notification","Message":"foo"}`,
+			notification: &Notification{Type: "Notification", Message: "foo"},
+		},
+		{
+			tName: "ok",
+			body: `{
+				"Type": "Notification",
+				"MessageId": "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+				"TopicArn": "arn:aws:sns:us-west-2:123456789012:MyTopic",
+				"Subject": "My First Message",
+				"Message": "Hello world!",
+				"Timestamp": "2012-05-02T00:54:06.655Z",
+				"SignatureVersion": "1",
+				"Signature": "EXAMPLE",
+				"SigningCertURL": "https://sns.us-west-2.amazonaws.com/cert.pem",
+				"UnsubscribeURL": "https://sns.us-west-2.amazonaws.com/unsubscribe",
+				"MessageAttributes": {
+					"String": {"Type": "String", "Value": "foo"},
+					"Number": {"Type": "Number", "Value": "1"},
+					"Binary": {"Type": "Binary", "Value": "Zm9v"}
+				}
+			}`,
+			notification: &Notification{
+				Type:             "Notification",
+				MessageID:        "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324",
+				TopicArn:         "arn:aws:sns:us-west-2:123456789012:MyTopic",
+				Subject:          "My First Message",
+				Message:          "Hello world!",
+				Timestamp:        time.Date(2012, 5, 2, 0, 54, 6, 655000000, time.UTC),
+				SignatureVersion: "1",
+				Signature:        "EXAMPLE",
+				SigningCertURL:   "https://sns.us-west-2.amazonaws.com/cert.pem",
+				UnsubscribeURL:   "https://sns.us-west-2.amazonaws.com/unsubscribe",
+				MessageAttributes: map[string]*sns.MessageAttributeValue{
+					"String": &sns.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String("foo"),
+					},
+					"Number": &sns.MessageAttributeValue{
+						DataType:    aws.String("Number"),
+						StringValue: aws.String("1"),
+					},
+					"Binary": &sns.MessageAttributeValue{
+						DataType:    aws.String("Binary"),
+						BinaryValue: []byte("foo"),
+					},
+				},
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			n, err := DecodeNotification([]byte(tc.body))
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.notification, n)
+		})
+	}
+}
+
+func TestNotification_SpanContext(t *testing.T) {
+	body := `{"MessageAttributes":{"B3-Trace-ID":{"Type":"String","Value":"` + ocawstest.DefaultTraceID.String() + `"},"B3-Span-ID":{"Type":"String","Value":"` + ocawstest.DefaultSpanID.String() + `"}}}`
+
+	n, err := DecodeNotification([]byte(body))
+	assert.NoError(t, err)
+
+	sc, ok := n.SpanContext(b3.New())
+	assert.True(t, ok)
+	assert.Equal(t, ocawstest.DefaultTraceID, sc.TraceID)
+	assert.Equal(t, ocawstest.DefaultSpanID, sc.SpanID)
+}
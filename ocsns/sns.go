@@ -2,16 +2,25 @@ package ocsns // import "go.krak3n.codes/ocaws/ocsns"
 
 import (
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
 	"go.krak3n.codes/ocaws"
+	"go.krak3n.codes/ocaws/offload"
 	"go.krak3n.codes/ocaws/propagation"
 	"go.krak3n.codes/ocaws/propagation/b3"
 	"go.opencensus.io/trace"
 )
 
+// Attributes recorded on spans by this package
+const (
+	MessageAttributesAttribute = "sns.message_attributes"
+	MessageSizeAttribute       = "sns.message_size"
+)
+
 // An Option function customizes a clients configuration
 type Option func(*SNS)
 
@@ -22,23 +31,64 @@ func WithPropagator(p propagation.Propagator) Option {
 	})
 }
 
-// SNS embeds the AWS SDK SNS client allowing to be used as a drop in
-// replacement for your existing SNS client.
+// WithFallbackPropagator sets the clients fallback propagator used when the
+// propagator would exceed the message attribute limit
+func WithFallbackPropagator(p propagation.Propagator) Option {
+	return Option(func(s *SNS) {
+		s.FallbackPropagator = p
+	})
+}
+
+// WithOversizePolicy sets what happens when adding span context message
+// attributes would exceed the maximum message size
+func WithOversizePolicy(p ocaws.OversizePolicy) Option {
+	return Option(func(s *SNS) {
+		s.OversizePolicy = p
+	})
+}
+
+// WithOffloader stores message bodies of messages which are too large in S3
+// using the offloader, consumers configured with ocsqs.WithOffloader download
+// the body with or without raw message delivery
+func WithOffloader(off *offload.Offloader) Option {
+	return Option(func(s *SNS) {
+		s.Offloader = off
+	})
+}
+
+// SNS embeds the AWS SDK SNS API interface allowing to be used as a drop in
+// replacement for your existing SNS client or any other implementation of
+// snsiface.SNSAPI.
 type SNS struct {
-	*sns.SNS
+	snsiface.SNSAPI
 
 	// Propagator defines how traces will be propagated, if not specified this
 	// will be B3
 	Propagator propagation.Propagator
+
+	// FallbackPropagator is used when the span context attributes added by
+	// the Propagator would exceed the message attribute limit, if not
+	// specified this will be the single attribute B3 propagator
+	FallbackPropagator propagation.Propagator
+
+	// OversizePolicy defines what happens when adding span context message
+	// attributes would exceed the maximum message size, by default the
+	// message is published as is
+	OversizePolicy ocaws.OversizePolicy
+
+	// Offloader, if set, stores message bodies of messages which are too
+	// large in S3 publishing a pointer to the body instead
+	Offloader *offload.Offloader
 }
 
 // New constructs a new SNS client with default configuration values. Use
 // Option functions to customise configuration. By default the propagator used
 // is B3.
-func New(client *sns.SNS, opts ...Option) *SNS {
+func New(client snsiface.SNSAPI, opts ...Option) *SNS {
 	s := &SNS{
-		SNS:        client,
-		Propagator: b3.New(),
+		SNSAPI:             client,
+		Propagator:         b3.New(),
+		FallbackPropagator: b3.NewSingle(),
 	}
 
 	for _, opt := range opts {
@@ -48,10 +98,21 @@ func New(client *sns.SNS, opts ...Option) *SNS {
 	return s
 }
 
+// SNS implements the snsiface.SNSAPI interface
+var _ snsiface.SNSAPI = (*SNS)(nil)
+
 // PublishWithContext wraps the AWS SDK SNS PublishWithContext method applying
-// span context to the input message attributes according the given propagator
+// span context to the input message attributes according the given propagator.
+// The message size is recorded on the span in the context, if the message
+// exceeds the maximum message size the OversizePolicy is applied. If an
+// Offloader is configured message bodies which are too large are stored in S3.
+// The message published and publish latency are recorded.
 func (sns *SNS) PublishWithContext(ctx aws.Context, input *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error) {
-	return publish(ctx, sns.SNS, sns.Propagator, input, opts...)
+	return publish(ctx, sns.SNSAPI, publishConfig{
+		propagators: []propagation.Propagator{sns.Propagator, sns.FallbackPropagator},
+		policy:      sns.OversizePolicy,
+		offloader:   sns.Offloader,
+	}, input, opts...)
 }
 
 // A publisher publishes messages to SNS
@@ -59,24 +120,70 @@ type publisher interface {
 	PublishWithContext(ctx aws.Context, input *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error)
 }
 
-// publish publishes messages to SNS
-func publish(ctx aws.Context, publisher publisher, propagator propagation.Propagator, in *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error) {
-	if span := trace.FromContext(ctx); span != nil {
-		if in.MessageAttributes == nil {
-			in.MessageAttributes = make(map[string]*sns.MessageAttributeValue)
+// publishConfig configures how messages are published
+type publishConfig struct {
+	propagators []propagation.Propagator
+	policy      ocaws.OversizePolicy
+	offloader   *offload.Offloader
+}
+
+// publish publishes messages to SNS, span context is added to the message
+// attributes by the first propagator whose attributes fit within the message
+// attribute limit. Message bodies which are too large are offloaded if an
+// offloader is configured whether or not there is a span in the context, a
+// *ocaws.MessageTooLargeError is returned without publishing if the message is
+// too large and the RejectOversize policy is used
+func publish(ctx aws.Context, publisher publisher, cfg publishConfig, in *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error) {
+	start := time.Now()
+
+	var err error
+	in.Message, in.MessageAttributes, err = messageWithSpan(ctx, trace.FromContext(ctx), in.TopicArn, in.Message, in.MessageAttributes, cfg)
+	if err != nil {
+		recordPublish(ctx, aws.StringValue(in.TopicArn), start, false, err)
+		return nil, err
+	}
+
+	out, err := publisher.PublishWithContext(ctx, in, opts...)
+	recordPublish(ctx, aws.StringValue(in.TopicArn), start, true, err)
+
+	return out, err
+}
+
+// messageWithSpan adds the span context to a copy of the message attributes
+// and applies the oversize policy, the message body is offloaded first if an
+// offloader is configured. The span may be nil in which case the body is only
+// offloaded. Offloading needs a message attribute for the size of the body so
+// the topic name and publish time are only added if there is still room once
+// the body has been offloaded.
+func messageWithSpan(ctx aws.Context, span *trace.Span, topicARN *string, body *string, attrs map[string]*sns.MessageAttributeValue, cfg publishConfig) (*string, map[string]*sns.MessageAttributeValue, error) {
+	orig := toCarrier(attrs)
+	prev := orig
+
+	var p *ocaws.Propagation
+	if span != nil {
+		p = messagePropagation(topicARN, cfg.propagators)
+	}
+
+	if cfg.offloader != nil {
+		size := ocaws.MessageSize(body, prev)
+		if p != nil {
+			withSpan, _ := p.Propagate(span.SpanContext(), prev)
+			size = ocaws.MessageSize(body, withSpan)
 		}
 
-		if propagator.SpanContextToMessageAttributes(span.SpanContext(), in.MessageAttributes) {
-			if in.TopicArn != nil {
-				in.MessageAttributes[ocaws.TraceTopicName] = &sns.MessageAttributeValue{
-					StringValue: aws.String(topicNameFromARN(*in.TopicArn)),
-					DataType:    aws.String("String"),
-				}
-			}
+		var err error
+		if body, prev, err = cfg.offloader.Offload(ctx, body, prev, size); err != nil {
+			return body, attrs, err
 		}
 	}
 
-	return publisher.PublishWithContext(ctx, in, opts...)
+	if span == nil {
+		return body, fromCarrier(attrs, orig, prev), nil
+	}
+
+	next, err := cfg.policy.Apply(span, MessageSizeAttribute, body, p.Apply(span, prev), prev)
+
+	return body, fromCarrier(attrs, orig, next), err
 }
 
 // topicNameFromARN grabs the topic name from an ARN, this breaks the ARN at
@@ -4,17 +4,24 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sns/snsiface"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.krak3n.codes/ocaws"
 	"go.krak3n.codes/ocaws/ocawstest"
+	"go.krak3n.codes/ocaws/offload"
 	"go.krak3n.codes/ocaws/propagation"
+	"go.krak3n.codes/ocaws/propagation/b3"
 	"go.krak3n.codes/ocaws/propagation/propagationtest"
 	"go.opencensus.io/trace"
 )
@@ -25,6 +32,18 @@ func (fn PublishWithContextFunc) PublishWithContext(ctx aws.Context, input *sns.
 	return fn(ctx, input, opts...)
 }
 
+// TestSNS implements the snsiface.SNSAPI allowing methods to be overridden
+// for testing, calling methods which are not overridden will panic
+type TestSNS struct {
+	snsiface.SNSAPI
+
+	PublishWithContextFunc PublishWithContextFunc
+}
+
+func (t *TestSNS) PublishWithContext(ctx aws.Context, input *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error) {
+	return t.PublishWithContextFunc(ctx, input, opts...)
+}
+
 func TestMain(m *testing.M) {
 	trace.ApplyConfig(trace.Config{
 		IDGenerator: ocawstest.NewTestIDGenerator(),
@@ -51,8 +70,9 @@ func TestNew(t *testing.T) {
 				WithPropagator(&propagationtest.TestPropator{}),
 			},
 			client: &SNS{
-				SNS:        snsclient,
-				Propagator: &propagationtest.TestPropator{},
+				SNSAPI:             snsclient,
+				Propagator:         &propagationtest.TestPropator{},
+				FallbackPropagator: b3.NewSingle(),
 			},
 		},
 	}
@@ -67,6 +87,157 @@ func TestNew(t *testing.T) {
 	}
 }
 
+func TestSNS_PublishWithContext(t *testing.T) {
+	client := New(&TestSNS{
+		PublishWithContextFunc: func(ctx aws.Context, input *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error) {
+			assert.Contains(t, input.MessageAttributes, ocaws.TraceTopicName)
+
+			return &sns.PublishOutput{
+				MessageId: aws.String("foo"),
+			}, nil
+		},
+	})
+
+	ctx, span := trace.StartSpan(context.Background(), t.Name())
+	defer span.End()
+
+	out, err := client.PublishWithContext(ctx, &sns.PublishInput{
+		TopicArn: aws.String("arn:aws:sns:us-east-2:123456789012:Foo"),
+		Message:  aws.String("foo"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "foo", aws.StringValue(out.MessageId))
+}
+
+type TestS3 struct {
+	s3iface.S3API
+
+	PutObjectWithContextFunc func(aws.Context, *s3.PutObjectInput, ...request.Option) (*s3.PutObjectOutput, error)
+}
+
+func (s *TestS3) PutObjectWithContext(ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	return s.PutObjectWithContextFunc(ctx, in, opts...)
+}
+
+func TestSNS_PublishWithContext_attributeValues(t *testing.T) {
+	client := New(&TestSNS{
+		PublishWithContextFunc: func(ctx aws.Context, input *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error) {
+			if assert.Contains(t, input.MessageAttributes, "Nil") {
+				assert.Nil(t, input.MessageAttributes["Nil"])
+			}
+
+			assert.Contains(t, input.MessageAttributes, ocaws.TraceTopicName)
+
+			return &sns.PublishOutput{}, nil
+		},
+	})
+
+	ctx, span := trace.StartSpan(context.Background(), t.Name())
+	defer span.End()
+
+	attrs := map[string]*sns.MessageAttributeValue{
+		"Nil": nil,
+	}
+
+	_, err := client.PublishWithContext(ctx, &sns.PublishInput{
+		TopicArn:          aws.String("arn:aws:sns:us-east-2:123456789012:Foo"),
+		Message:           aws.String("foo"),
+		MessageAttributes: attrs,
+	})
+	require.NoError(t, err)
+	assert.Len(t, attrs, 1)
+}
+
+func TestSNS_PublishWithContext_offload(t *testing.T) {
+	body := strings.Repeat("a", ocaws.MaxMessageSize+1)
+
+	type TestCase struct {
+		tName string
+		span  bool
+		attrs int
+		keys  []string
+	}
+	tt := []TestCase{
+		{
+			tName: "with span",
+			span:  true,
+			keys:  []string{b3.TraceIDKey, b3.SpanIDKey, b3.SpanSampledKey, ocaws.TraceTopicName, ocaws.TraceSentTimestamp},
+		},
+		{
+			tName: "topic name dropped for the payload size",
+			span:  true,
+			attrs: 6,
+			keys:  []string{b3.TraceIDKey, b3.SpanIDKey, b3.SpanSampledKey},
+		},
+		{
+			tName: "no span",
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			var puts int32
+
+			off := offload.New(&TestS3{
+				PutObjectWithContextFunc: func(ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+					atomic.AddInt32(&puts, 1)
+
+					assert.NotNil(t, trace.FromContext(ctx))
+					assert.Equal(t, "foo", aws.StringValue(in.Bucket))
+					assert.Equal(t, "bar", aws.StringValue(in.Key))
+
+					return &s3.PutObjectOutput{}, nil
+				},
+			}, "foo", offload.WithKeyFunc(func() string { return "bar" }))
+
+			client := New(&TestSNS{
+				PublishWithContextFunc: func(ctx aws.Context, input *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error) {
+					assert.Equal(t, offload.Pointer{Bucket: "foo", Key: "bar"}.String(), aws.StringValue(input.Message))
+					require.Contains(t, input.MessageAttributes, offload.SizeAttribute)
+					assert.Equal(t, fmt.Sprint(len(body)), aws.StringValue(input.MessageAttributes[offload.SizeAttribute].StringValue))
+
+					if tc.span {
+						assert.Len(t, input.MessageAttributes, tc.attrs+len(tc.keys)+1)
+					}
+
+					for _, k := range tc.keys {
+						assert.Contains(t, input.MessageAttributes, k)
+					}
+
+					return &sns.PublishOutput{
+						MessageId: aws.String("foo"),
+					}, nil
+				},
+			}, WithOffloader(off), WithOversizePolicy(ocaws.RejectOversize))
+
+			ctx := context.Background()
+			if tc.span {
+				var span *trace.Span
+				ctx, span = trace.StartSpan(ctx, t.Name())
+				defer span.End()
+			}
+
+			attrs := make(map[string]*sns.MessageAttributeValue)
+			for i := 0; i < tc.attrs; i++ {
+				attrs[fmt.Sprintf("Attr%d", i)] = &sns.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String("foo"),
+				}
+			}
+
+			_, err := client.PublishWithContext(ctx, &sns.PublishInput{
+				TopicArn:          aws.String("arn:aws:sns:us-east-2:123456789012:Foo"),
+				Message:           aws.String(body),
+				MessageAttributes: attrs,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&puts))
+		})
+	}
+}
+
 func Test_publish(t *testing.T) {
 	type TestCase struct {
 		tName      string
@@ -137,6 +308,10 @@ func Test_publish(t *testing.T) {
 						},
 					}
 
+					require.Contains(t, input.MessageAttributes, ocaws.TraceSentTimestamp)
+					assert.Equal(t, "Number", aws.StringValue(input.MessageAttributes[ocaws.TraceSentTimestamp].DataType))
+					delete(input.MessageAttributes, ocaws.TraceSentTimestamp)
+
 					assert.Equal(t, attr, input.MessageAttributes)
 					return nil, nil
 				})
@@ -151,13 +326,88 @@ func Test_publish(t *testing.T) {
 		t.Run(tc.tName, func(t *testing.T) {
 			t.Parallel()
 
-			_, err := publish(tc.ctx, tc.publisher(t), tc.propagator, tc.in)
+			_, err := publish(tc.ctx, tc.publisher(t), publishConfig{
+				propagators: []propagation.Propagator{tc.propagator},
+				policy:      ocaws.SendOversize,
+			}, tc.in)
 
 			assert.Equal(t, tc.err, err)
 		})
 	}
 }
 
+func Test_messagePropagation(t *testing.T) {
+	attrs := func(n int) map[string]*sns.MessageAttributeValue {
+		attrs := make(map[string]*sns.MessageAttributeValue, n)
+		for i := 0; i < n; i++ {
+			attrs[fmt.Sprintf("Attr%d", i)] = &sns.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String("foo"),
+			}
+		}
+
+		return attrs
+	}
+
+	type TestCase struct {
+		tName string
+		attrs map[string]*sns.MessageAttributeValue
+		keys  []string
+	}
+	tt := []TestCase{
+		{
+			tName: "fits with sent timestamp",
+			attrs: attrs(5),
+			keys:  []string{b3.TraceIDKey, b3.SpanIDKey, b3.SpanSampledKey, ocaws.TraceTopicName, ocaws.TraceSentTimestamp},
+		},
+		{
+			tName: "fits",
+			attrs: attrs(6),
+			keys:  []string{b3.TraceIDKey, b3.SpanIDKey, b3.SpanSampledKey, ocaws.TraceTopicName},
+		},
+		{
+			tName: "fits without topic name",
+			attrs: attrs(7),
+			keys:  []string{b3.TraceIDKey, b3.SpanIDKey, b3.SpanSampledKey},
+		},
+		{
+			tName: "fallback",
+			attrs: attrs(8),
+			keys:  []string{b3.SingleKey, ocaws.TraceTopicName},
+		},
+		{
+			tName: "fallback without topic name",
+			attrs: attrs(9),
+			keys:  []string{b3.SingleKey},
+		},
+		{
+			tName: "skipped",
+			attrs: attrs(10),
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			_, span := trace.StartSpan(context.Background(), t.Name())
+			defer span.End()
+
+			n := len(tc.attrs)
+			p := messagePropagation(
+				aws.String("arn:aws:sns:us-east-2:123456789012:Foo"),
+				[]propagation.Propagator{b3.New(), b3.NewSingle()})
+
+			attrs := p.Apply(span, toCarrier(tc.attrs))
+
+			assert.Len(t, attrs, n+len(tc.keys))
+			for _, k := range tc.keys {
+				assert.Contains(t, attrs, k)
+			}
+		})
+	}
+}
+
 func Test_topicNameFromARN(t *testing.T) {
 	type TestCase struct {
 		tName string
@@ -0,0 +1,64 @@
+package ocsns
+
+import (
+	"context"
+	"time"
+
+	"go.krak3n.codes/ocaws"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// KeyTopic is the tag holding the name of the topic
+var KeyTopic = tag.MustNewKey("sns_topic")
+
+// Measures recorded by the SNS client
+var (
+	MessagesPublished = stats.Int64(
+		"go.krak3n.codes/ocaws/sns/messages_published",
+		"Number of messages published",
+		stats.UnitDimensionless)
+	PublishLatency = stats.Float64(
+		"go.krak3n.codes/ocaws/sns/publish_latency",
+		"Time taken to publish a message",
+		stats.UnitMilliseconds)
+)
+
+// Views for the measures recorded by this package
+var (
+	MessagesPublishedView = &view.View{
+		Name:        "go.krak3n.codes/ocaws/sns/messages_published",
+		Description: "Number of messages published, by topic and outcome",
+		Measure:     MessagesPublished,
+		TagKeys:     []tag.Key{KeyTopic, ocaws.KeyOutcome},
+		Aggregation: view.Sum(),
+	}
+	PublishLatencyView = &view.View{
+		Name:        "go.krak3n.codes/ocaws/sns/publish_latency",
+		Description: "Latency distribution of publishing messages, by topic and outcome",
+		Measure:     PublishLatency,
+		TagKeys:     []tag.Key{KeyTopic, ocaws.KeyOutcome},
+		Aggregation: ocaws.DefaultLatencyDistribution,
+	}
+)
+
+// DefaultViews are the default views provided by this package
+var DefaultViews = []*view.View{
+	MessagesPublishedView,
+	PublishLatencyView,
+}
+
+// recordPublish records the outcome of publishing a message, the latency is
+// only recorded if the message was passed to SNS
+func recordPublish(ctx context.Context, topicARN string, start time.Time, published bool, err error) {
+	ms := []stats.Measurement{MessagesPublished.M(1)}
+	if published {
+		ms = append(ms, PublishLatency.M(float64(time.Since(start).Nanoseconds())/1e6))
+	}
+
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(KeyTopic, topicNameFromARN(topicARN)),
+		tag.Upsert(ocaws.KeyOutcome, ocaws.Outcome(err)),
+	}, ms...)
+}
@@ -0,0 +1,63 @@
+package ocsns
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.krak3n.codes/ocaws"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// viewRow returns the data of the row of the view with the given topic and
+// outcome tags, nil is returned if there is no such row
+func viewRow(t *testing.T, v *view.View, topic, outcome string) view.AggregationData {
+	rows, err := view.RetrieveData(v.Name)
+	require.NoError(t, err)
+
+	for _, row := range rows {
+		tags := make(map[tag.Key]string)
+		for _, t := range row.Tags {
+			tags[t.Key] = t.Value
+		}
+
+		if tags[KeyTopic] == topic && tags[ocaws.KeyOutcome] == outcome {
+			return row.Data
+		}
+	}
+
+	return nil
+}
+
+func TestStats(t *testing.T) {
+	require.NoError(t, view.Register(DefaultViews...))
+	defer view.Unregister(DefaultViews...)
+
+	client := New(&TestSNS{
+		PublishWithContextFunc: func(ctx aws.Context, input *sns.PublishInput, opts ...request.Option) (*sns.PublishOutput, error) {
+			if aws.StringValue(input.Message) == "fail" {
+				return nil, errors.New("boom")
+			}
+
+			return &sns.PublishOutput{}, nil
+		},
+	})
+
+	for _, msg := range []string{"ok", "ok", "fail"} {
+		client.PublishWithContext(context.Background(), &sns.PublishInput{
+			TopicArn: aws.String("arn:aws:sns:us-east-2:123456789012:Stats"),
+			Message:  aws.String(msg),
+		})
+	}
+
+	assert.Equal(t, float64(2), viewRow(t, MessagesPublishedView, "Stats", ocaws.OutcomeOK).(*view.SumData).Value)
+	assert.Equal(t, float64(1), viewRow(t, MessagesPublishedView, "Stats", ocaws.OutcomeError).(*view.SumData).Value)
+	assert.Equal(t, int64(2), viewRow(t, PublishLatencyView, "Stats", ocaws.OutcomeOK).(*view.DistributionData).Count)
+	assert.Equal(t, int64(1), viewRow(t, PublishLatencyView, "Stats", ocaws.OutcomeError).(*view.DistributionData).Count)
+}
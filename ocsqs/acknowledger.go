@@ -0,0 +1,253 @@
+package ocsqs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.krak3n.codes/ocaws"
+	"go.opencensus.io/trace"
+)
+
+// Acknowledger defaults
+const (
+	DefaultAckInterval = 100 * time.Millisecond
+	MaxAckBatchSize    = 10
+)
+
+// ErrAcknowledgerClosed is returned when acknowledging a message after the
+// Acknowledger has been closed
+var ErrAcknowledgerClosed = errors.New("ocsqs: acknowledger closed")
+
+// An AcknowledgerOption customizes an Acknowledger
+type AcknowledgerOption func(*Acknowledger)
+
+// WithAckInterval sets the maximum time an acknowledgement waits to be
+// flushed in a batch
+func WithAckInterval(d time.Duration) AcknowledgerOption {
+	return AcknowledgerOption(func(a *Acknowledger) {
+		a.interval = d
+	})
+}
+
+// An Acknowledger deletes messages from a queue in batches. Messages are
+// collected until there are 10 or the ack interval has passed since the first
+// message was collected and then deleted with a single DeleteMessageBatch
+// call. Entries which fail to delete in the batch are retried individually.
+type Acknowledger struct {
+	client   sqsiface.SQSAPI
+	queueURL string
+	interval time.Duration
+
+	mtx    sync.RWMutex
+	closed bool
+	ackC   chan *ack
+	wg     sync.WaitGroup
+}
+
+// ack is a message waiting to be deleted
+type ack struct {
+	msg     *sqs.Message
+	resultC chan ackResult
+}
+
+// ackResult is the outcome of deleting a message
+type ackResult struct {
+	// batchErr is the reason the batch entry failed if the message was
+	// retried individually
+	batchErr string
+	err      error
+}
+
+// NewAcknowledger constructs and starts a new Acknowledger for the given
+// queue, Close must be called to flush outstanding acknowledgements.
+func NewAcknowledger(client sqsiface.SQSAPI, queueURL string, opts ...AcknowledgerOption) *Acknowledger {
+	a := &Acknowledger{
+		client:   client,
+		queueURL: queueURL,
+		interval: DefaultAckInterval,
+		ackC:     make(chan *ack),
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	a.wg.Add(1)
+	go a.run()
+
+	return a
+}
+
+// Ack deletes the message from the queue, blocking until the batch holding
+// the message has been flushed or the context is done. The message may still
+// be deleted if the context is done after it was added to a batch. The
+// outcome is annotated on the span in the context, use the context returned
+// by StartSpan.
+func (a *Acknowledger) Ack(ctx context.Context, msg *sqs.Message) error {
+	resultC := make(chan ackResult, 1)
+
+	a.mtx.RLock()
+	if a.closed {
+		a.mtx.RUnlock()
+		return ErrAcknowledgerClosed
+	}
+
+	select {
+	case <-ctx.Done():
+		a.mtx.RUnlock()
+		return ctx.Err()
+	case a.ackC <- &ack{msg: msg, resultC: resultC}:
+	}
+	a.mtx.RUnlock()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case res := <-resultC:
+		annotateAckResult(trace.FromContext(ctx), res)
+		return res.err
+	}
+}
+
+// Close flushes outstanding acknowledgements and stops the Acknowledger,
+// waiting for batches being flushed. Subsequent calls to Ack return
+// ErrAcknowledgerClosed.
+func (a *Acknowledger) Close() error {
+	a.mtx.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.ackC)
+	}
+	a.mtx.Unlock()
+
+	a.wg.Wait()
+
+	return nil
+}
+
+// run collects acknowledgements flushing them when the batch is full or the
+// interval has passed since the first acknowledgement in the batch. Batches
+// are flushed in their own goroutine so a slow delete does not hold up
+// collecting the next batch, each caller of Ack has at most one message in a
+// batch so the number of flushes in flight is bounded by the callers.
+func (a *Acknowledger) run() {
+	defer a.wg.Done()
+
+	var (
+		batch  []*ack
+		timer  *time.Timer
+		timerC <-chan time.Time
+	)
+
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timerC = nil, nil
+		}
+
+		a.wg.Add(1)
+		go func(batch []*ack) {
+			defer a.wg.Done()
+			a.flush(batch)
+		}(batch)
+
+		batch = nil
+	}
+
+	for {
+		select {
+		case ack, ok := <-a.ackC:
+			if !ok {
+				if len(batch) > 0 {
+					flush()
+				}
+
+				return
+			}
+
+			batch = append(batch, ack)
+			if len(batch) == 1 {
+				timer = time.NewTimer(a.interval)
+				timerC = timer.C
+			}
+
+			if len(batch) == MaxAckBatchSize {
+				flush()
+			}
+		case <-timerC:
+			flush()
+		}
+	}
+}
+
+// flush deletes the batch of messages, retrying failed entries individually
+func (a *Acknowledger) flush(batch []*ack) {
+	ctx := context.Background()
+
+	entries := make([]*sqs.DeleteMessageBatchRequestEntry, len(batch))
+	for i, ack := range batch {
+		entries[i] = &sqs.DeleteMessageBatchRequestEntry{
+			Id:            aws.String(strconv.Itoa(i)),
+			ReceiptHandle: ack.msg.ReceiptHandle,
+		}
+	}
+
+	out, err := a.client.DeleteMessageBatchWithContext(ctx, &sqs.DeleteMessageBatchInput{
+		QueueUrl: aws.String(a.queueURL),
+		Entries:  entries,
+	})
+
+	failed := make(map[string]string)
+	if err != nil {
+		for _, entry := range entries {
+			failed[*entry.Id] = err.Error()
+		}
+	} else {
+		for _, entry := range out.Failed {
+			failed[aws.StringValue(entry.Id)] = aws.StringValue(entry.Code) + ": " + aws.StringValue(entry.Message)
+		}
+	}
+
+	for i, ack := range batch {
+		reason, ok := failed[strconv.Itoa(i)]
+		if !ok {
+			record(ctx, a.queueURL, ocaws.OutcomeOK, MessagesDeleted.M(1))
+			ack.resultC <- ackResult{}
+
+			continue
+		}
+
+		_, err := a.client.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(a.queueURL),
+			ReceiptHandle: ack.msg.ReceiptHandle,
+		})
+		record(ctx, a.queueURL, ocaws.Outcome(err), MessagesDeleted.M(1))
+
+		ack.resultC <- ackResult{
+			batchErr: reason,
+			err:      err,
+		}
+	}
+}
+
+// annotateAckResult annotates the span with the outcome of deleting a message
+func annotateAckResult(span *trace.Span, res ackResult) {
+	if span == nil {
+		return
+	}
+
+	switch {
+	case res.err != nil:
+		span.Annotate(nil, "Failed to delete message: "+res.err.Error())
+	case res.batchErr != "":
+		span.Annotate(nil, "Message deleted after batch entry failed: "+res.batchErr)
+	default:
+		span.Annotate(nil, "Message deleted")
+	}
+}
@@ -0,0 +1,178 @@
+package ocsqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/trace"
+)
+
+func TestAcknowledger_Ack(t *testing.T) {
+	type TestCase struct {
+		tName      string
+		batchOut   *sqs.DeleteMessageBatchOutput
+		batchErr   error
+		deleteErr  error
+		err        error
+		annotation string
+	}
+	tt := []TestCase{
+		{
+			tName:      "deleted",
+			batchOut:   &sqs.DeleteMessageBatchOutput{},
+			annotation: "Message deleted",
+		},
+		{
+			tName: "entry failed",
+			batchOut: &sqs.DeleteMessageBatchOutput{
+				Failed: []*sqs.BatchResultErrorEntry{
+					{Id: aws.String("0"), Code: aws.String("Foo"), Message: aws.String("boom")},
+				},
+			},
+			annotation: "Message deleted after batch entry failed: Foo: boom",
+		},
+		{
+			tName:      "batch error",
+			batchErr:   errors.New("boom"),
+			annotation: "Message deleted after batch entry failed: boom",
+		},
+		{
+			tName:      "retry failed",
+			batchErr:   errors.New("boom"),
+			deleteErr:  errors.New("bang"),
+			err:        errors.New("bang"),
+			annotation: "Failed to delete message: bang",
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			client := &TestSQS{
+				DeleteMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.DeleteMessageBatchInput, opts ...request.Option) (*sqs.DeleteMessageBatchOutput, error) {
+					assert.Equal(t, "foo", aws.StringValue(in.QueueUrl))
+					require.Len(t, in.Entries, 1)
+					assert.Equal(t, "bar", aws.StringValue(in.Entries[0].ReceiptHandle))
+
+					return tc.batchOut, tc.batchErr
+				},
+				DeleteMessageWithContextFunc: func(ctx aws.Context, in *sqs.DeleteMessageInput, opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+					assert.Equal(t, "bar", aws.StringValue(in.ReceiptHandle))
+
+					return &sqs.DeleteMessageOutput{}, tc.deleteErr
+				},
+			}
+
+			a := NewAcknowledger(client, "foo", WithAckInterval(time.Millisecond))
+			defer a.Close()
+
+			ctx, span := trace.StartSpan(context.Background(), t.Name(), trace.WithSampler(trace.AlwaysSample()))
+
+			err := a.Ack(ctx, &sqs.Message{ReceiptHandle: aws.String("bar")})
+			assert.Equal(t, tc.err, err)
+
+			span.End()
+
+			sd, ok := exporter.Span(t.Name())
+			require.True(t, ok)
+			require.Len(t, sd.Annotations, 1)
+			assert.Equal(t, tc.annotation, sd.Annotations[0].Message)
+		})
+	}
+}
+
+func TestAcknowledger_batchSize(t *testing.T) {
+	var calls int32
+
+	client := &TestSQS{
+		DeleteMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.DeleteMessageBatchInput, opts ...request.Option) (*sqs.DeleteMessageBatchOutput, error) {
+			atomic.AddInt32(&calls, 1)
+			assert.Len(t, in.Entries, MaxAckBatchSize)
+
+			return &sqs.DeleteMessageBatchOutput{}, nil
+		},
+	}
+
+	// The interval is never reached so batches are only flushed when full
+	a := NewAcknowledger(client, "foo", WithAckInterval(time.Hour))
+	defer a.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < MaxAckBatchSize*2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			err := a.Ack(context.Background(), &sqs.Message{ReceiptHandle: aws.String(fmt.Sprint(i))})
+			assert.NoError(t, err)
+		}(i)
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestAcknowledger_slowDelete(t *testing.T) {
+	var calls int32
+	releaseC := make(chan struct{})
+
+	client := &TestSQS{
+		DeleteMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.DeleteMessageBatchInput, opts ...request.Option) (*sqs.DeleteMessageBatchOutput, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				<-releaseC
+			}
+
+			return &sqs.DeleteMessageBatchOutput{}, nil
+		},
+	}
+
+	a := NewAcknowledger(client, "foo", WithAckInterval(time.Millisecond))
+	defer a.Close()
+	defer close(releaseC)
+
+	// The first batch is stuck deleting, the Ack returns once cancelled
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := a.Ack(ctx, &sqs.Message{ReceiptHandle: aws.String("slow")})
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// The next batch is flushed while the first is still deleting
+	err = a.Ack(context.Background(), &sqs.Message{ReceiptHandle: aws.String("fast")})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestAcknowledger_Close(t *testing.T) {
+	client := &TestSQS{
+		DeleteMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.DeleteMessageBatchInput, opts ...request.Option) (*sqs.DeleteMessageBatchOutput, error) {
+			assert.Len(t, in.Entries, 1)
+			return &sqs.DeleteMessageBatchOutput{}, nil
+		},
+	}
+
+	a := NewAcknowledger(client, "foo", WithAckInterval(time.Hour))
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- a.Ack(context.Background(), &sqs.Message{ReceiptHandle: aws.String("bar")})
+	}()
+
+	// Give the acknowledgement time to be collected before closing
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, a.Close())
+	assert.NoError(t, <-errC)
+
+	assert.Equal(t, ErrAcknowledgerClosed, a.Ack(context.Background(), &sqs.Message{}))
+}
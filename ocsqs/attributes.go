@@ -0,0 +1,113 @@
+package ocsqs
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.krak3n.codes/ocaws"
+	"go.krak3n.codes/ocaws/propagation"
+	"go.opencensus.io/trace"
+)
+
+// toCarrier converts SQS message attributes to ocaws.MessageAttributes
+func toCarrier(attrs map[string]*sqs.MessageAttributeValue) ocaws.MessageAttributes {
+	if attrs == nil {
+		return nil
+	}
+
+	c := make(ocaws.MessageAttributes, len(attrs))
+	for k, v := range attrs {
+		if v == nil {
+			continue
+		}
+
+		c[k] = ocaws.MessageAttributeValue{
+			DataType:    aws.StringValue(v.DataType),
+			StringValue: v.StringValue,
+			BinaryValue: v.BinaryValue,
+		}
+	}
+
+	return c
+}
+
+// fromCarrier returns a copy of the SQS message attributes with the
+// attributes of c which were added or changed since prev, the carrier the
+// attributes were converted to by toCarrier. The values of the given message
+// attributes are copied as they are as the carrier does not hold every value.
+func fromCarrier(attrs map[string]*sqs.MessageAttributeValue, prev, c ocaws.MessageAttributes) map[string]*sqs.MessageAttributeValue {
+	if attrs == nil && c == nil {
+		return nil
+	}
+
+	dst := copyMessageAttributes(attrs)
+	if dst == nil {
+		dst = make(map[string]*sqs.MessageAttributeValue, len(c))
+	}
+
+	for k, v := range c.Changed(prev) {
+		dst[k] = &sqs.MessageAttributeValue{
+			DataType:    aws.String(v.DataType),
+			StringValue: v.StringValue,
+			BinaryValue: v.BinaryValue,
+		}
+	}
+
+	return dst
+}
+
+// copyMessageAttributes returns a shallow copy of the message attributes, nil
+// is returned if the attributes are nil
+func copyMessageAttributes(attrs map[string]*sqs.MessageAttributeValue) map[string]*sqs.MessageAttributeValue {
+	if attrs == nil {
+		return nil
+	}
+
+	dst := make(map[string]*sqs.MessageAttributeValue, len(attrs))
+	for k, v := range attrs {
+		dst[k] = v
+	}
+
+	return dst
+}
+
+// copyMessageSystemAttributes returns a shallow copy of the message system
+// attributes, nil is returned if the attributes are nil
+func copyMessageSystemAttributes(attrs map[string]*sqs.MessageSystemAttributeValue) map[string]*sqs.MessageSystemAttributeValue {
+	if attrs == nil {
+		return nil
+	}
+
+	dst := make(map[string]*sqs.MessageSystemAttributeValue, len(attrs))
+	for k, v := range attrs {
+		dst[k] = v
+	}
+
+	return dst
+}
+
+// injectMessageAttributes applies the span context to new SQS message
+// attributes using the propagator
+func injectMessageAttributes(p propagation.Propagator, sc trace.SpanContext) (ocaws.MessageAttributes, bool) {
+	attrs := make(map[string]*sqs.MessageAttributeValue)
+	ok := p.SpanContextToMessageAttributes(sc, attrs)
+
+	return toCarrier(attrs), ok
+}
+
+// messagePropagation returns the propagation of span contexts to messages
+// sent to the queue, the queue url is added if there is room
+func messagePropagation(queueURL *string, o *Options) *ocaws.Propagation {
+	p := &ocaws.Propagation{
+		Propagators:    []propagation.Propagator{o.Propagator, o.FallbackPropagator},
+		Inject:         injectMessageAttributes,
+		CountAttribute: MessageAttributesAttribute,
+	}
+
+	if queueURL != nil {
+		p.Extras = append(p.Extras, ocaws.MessageAttributes{
+			ocaws.TraceQueueURL: ocaws.StringAttribute(*queueURL),
+		})
+	}
+
+	return p
+}
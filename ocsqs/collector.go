@@ -0,0 +1,192 @@
+package ocsqs
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.opencensus.io/metric"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricproducer"
+)
+
+// DefaultCollectorInterval is how often queue attributes are collected by
+// default, SQS only updates the approximate counts about once a minute
+const DefaultCollectorInterval = time.Minute
+
+// Gauges exported by the Collector
+const (
+	MessagesVisibleGauge  = "go.krak3n.codes/ocaws/sqs/approximate_number_of_messages"
+	MessagesInFlightGauge = "go.krak3n.codes/ocaws/sqs/approximate_number_of_messages_not_visible"
+	MessagesDelayedGauge  = "go.krak3n.codes/ocaws/sqs/approximate_number_of_messages_delayed"
+)
+
+// QueueNameLabel is the label holding the name of the queue on gauges
+// exported by the Collector
+const QueueNameLabel = "queue_name"
+
+// A CollectorOption customizes a Collector
+type CollectorOption func(*Collector)
+
+// WithCollectorInterval sets how often queue attributes are collected,
+// intervals less than or equal to zero use DefaultCollectorInterval
+func WithCollectorInterval(d time.Duration) CollectorOption {
+	return CollectorOption(func(c *Collector) {
+		c.interval = d
+	})
+}
+
+// WithCollectorErrorHandler sets a function called when the attributes of a
+// queue cannot be collected, the gauges for the queue keep their previous
+// values
+func WithCollectorErrorHandler(fn func(queueURL string, err error)) CollectorOption {
+	return CollectorOption(func(c *Collector) {
+		c.errorHandler = fn
+	})
+}
+
+// A Collector periodically collects the approximate number of visible, in
+// flight and delayed messages of a set of queues, exporting them as
+// OpenCensus gauges labelled with the queue name.
+type Collector struct {
+	client       sqsiface.SQSAPI
+	queueURLs    []string
+	interval     time.Duration
+	errorHandler func(string, error)
+
+	registry *metric.Registry
+	visible  *metric.Int64Gauge
+	inFlight *metric.Int64Gauge
+	delayed  *metric.Int64Gauge
+}
+
+// NewCollector constructs a new Collector for the given queues. Use
+// CollectorOption functions to customise configuration.
+func NewCollector(client sqsiface.SQSAPI, queueURLs []string, opts ...CollectorOption) *Collector {
+	r := metric.NewRegistry()
+
+	c := &Collector{
+		client:       client,
+		queueURLs:    queueURLs,
+		interval:     DefaultCollectorInterval,
+		errorHandler: func(string, error) {},
+		registry:     r,
+		visible:      mustInt64Gauge(r, MessagesVisibleGauge, "Approximate number of messages available to be received"),
+		inFlight:     mustInt64Gauge(r, MessagesInFlightGauge, "Approximate number of messages received but not yet deleted"),
+		delayed:      mustInt64Gauge(r, MessagesDelayedGauge, "Approximate number of messages delayed and not yet available to be received"),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.interval <= 0 {
+		c.interval = DefaultCollectorInterval
+	}
+
+	return c
+}
+
+// Read implements the metricproducer.Producer interface returning the
+// collected gauges
+func (c *Collector) Read() []*metricdata.Metric {
+	return c.registry.Read()
+}
+
+// Run registers the Collector with the global metric producer manager and
+// collects queue attributes immediately and then every interval until the
+// context is done, at which point the Collector is removed from the manager
+// and Run returns nil.
+func (c *Collector) Run(ctx context.Context) error {
+	metricproducer.GlobalManager().AddProducer(c)
+	defer metricproducer.GlobalManager().DeleteProducer(c)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.Collect(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Collect collects the attributes of each queue once, updating the gauges.
+// The error handler is called for each queue whose attributes could not be
+// collected, errors caused by the context being done are not handled.
+func (c *Collector) Collect(ctx context.Context) {
+	for _, queueURL := range c.queueURLs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if err := c.collect(ctx, queueURL); err != nil && ctx.Err() == nil {
+			c.errorHandler(queueURL, err)
+		}
+	}
+}
+
+// collect collects the attributes of a single queue
+func (c *Collector) collect(ctx context.Context, queueURL string) error {
+	out, err := c.client.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(queueURL),
+		AttributeNames: aws.StringSlice([]string{
+			sqs.QueueAttributeNameApproximateNumberOfMessages,
+			sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+			sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+		}),
+	})
+	if err != nil {
+		return err
+	}
+
+	name := metricdata.NewLabelValue(queueNameFromURL(queueURL))
+
+	gauges := map[string]*metric.Int64Gauge{
+		sqs.QueueAttributeNameApproximateNumberOfMessages:           c.visible,
+		sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible: c.inFlight,
+		sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed:    c.delayed,
+	}
+
+	for attr, gauge := range gauges {
+		v, ok := out.Attributes[attr]
+		if !ok || v == nil {
+			continue
+		}
+
+		n, err := strconv.ParseInt(*v, 10, 64)
+		if err != nil {
+			return err
+		}
+
+		entry, err := gauge.GetEntry(name)
+		if err != nil {
+			return err
+		}
+
+		entry.Set(n)
+	}
+
+	return nil
+}
+
+// mustInt64Gauge adds an Int64 gauge labelled with the queue name to the
+// registry, panicking if the gauge cannot be added
+func mustInt64Gauge(r *metric.Registry, name, description string) *metric.Int64Gauge {
+	g, err := r.AddInt64Gauge(name,
+		metric.WithDescription(description),
+		metric.WithUnit(metricdata.UnitDimensionless),
+		metric.WithLabelKeys(QueueNameLabel))
+	if err != nil {
+		panic(err)
+	}
+
+	return g
+}
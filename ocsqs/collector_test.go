@@ -0,0 +1,166 @@
+package ocsqs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/metric/metricdata"
+	"go.opencensus.io/metric/metricproducer"
+)
+
+// gaugeValues returns the values of the gauge by queue name
+func gaugeValues(t *testing.T, c *Collector, name string) map[string]int64 {
+	values := make(map[string]int64)
+
+	for _, m := range c.Read() {
+		if m.Descriptor.Name != name {
+			continue
+		}
+
+		require.Equal(t, metricdata.TypeGaugeInt64, m.Descriptor.Type)
+		require.Equal(t, []metricdata.LabelKey{{Key: QueueNameLabel}}, m.Descriptor.LabelKeys)
+
+		for _, ts := range m.TimeSeries {
+			require.NotEmpty(t, ts.Points)
+			values[ts.LabelValues[0].Value] = ts.Points[0].Value.(int64)
+		}
+	}
+
+	return values
+}
+
+func TestCollector_Collect(t *testing.T) {
+	client := &TestSQS{
+		GetQueueAttributesWithContextFunc: func(ctx aws.Context, in *sqs.GetQueueAttributesInput, opts ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+			assert.ElementsMatch(t, []string{
+				sqs.QueueAttributeNameApproximateNumberOfMessages,
+				sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+				sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+			}, aws.StringValueSlice(in.AttributeNames))
+
+			if aws.StringValue(in.QueueUrl) == "https://sqs.eu-west-1.amazonaws.com/123456789101112/Fail" {
+				return nil, errors.New("boom")
+			}
+
+			return &sqs.GetQueueAttributesOutput{
+				Attributes: aws.StringMap(map[string]string{
+					sqs.QueueAttributeNameApproximateNumberOfMessages:           "3",
+					sqs.QueueAttributeNameApproximateNumberOfMessagesNotVisible: "2",
+					sqs.QueueAttributeNameApproximateNumberOfMessagesDelayed:    "1",
+				}),
+			}, nil
+		},
+	}
+
+	var failed []string
+
+	c := NewCollector(client, []string{
+		"https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo",
+		"https://sqs.eu-west-1.amazonaws.com/123456789101112/Fail",
+	}, WithCollectorErrorHandler(func(queueURL string, err error) {
+		assert.EqualError(t, err, "boom")
+		failed = append(failed, queueURL)
+	}))
+
+	c.Collect(context.Background())
+
+	assert.Equal(t, []string{"https://sqs.eu-west-1.amazonaws.com/123456789101112/Fail"}, failed)
+	assert.Equal(t, map[string]int64{"Foo": 3}, gaugeValues(t, c, MessagesVisibleGauge))
+	assert.Equal(t, map[string]int64{"Foo": 2}, gaugeValues(t, c, MessagesInFlightGauge))
+	assert.Equal(t, map[string]int64{"Foo": 1}, gaugeValues(t, c, MessagesDelayedGauge))
+}
+
+func TestNewCollector_interval(t *testing.T) {
+	type TestCase struct {
+		tName    string
+		interval time.Duration
+	}
+	tt := []TestCase{
+		{
+			tName: "zero",
+		},
+		{
+			tName:    "negative",
+			interval: -time.Second,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			c := NewCollector(&TestSQS{}, []string{"foo"}, WithCollectorInterval(tc.interval))
+			assert.Equal(t, DefaultCollectorInterval, c.interval)
+		})
+	}
+}
+
+func TestCollector_Collect_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &TestSQS{
+		GetQueueAttributesWithContextFunc: func(ctx aws.Context, in *sqs.GetQueueAttributesInput, opts ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+			cancel()
+			return nil, ctx.Err()
+		},
+	}
+
+	c := NewCollector(client, []string{"foo", "bar"}, WithCollectorErrorHandler(func(queueURL string, err error) {
+		t.Errorf("unexpected error collecting %s: %v", queueURL, err)
+	}))
+
+	c.Collect(ctx)
+}
+
+func TestCollector_Run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int32
+
+	client := &TestSQS{
+		GetQueueAttributesWithContextFunc: func(ctx aws.Context, in *sqs.GetQueueAttributesInput, opts ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+			atomic.AddInt32(&calls, 1)
+
+			return &sqs.GetQueueAttributesOutput{
+				Attributes: aws.StringMap(map[string]string{
+					sqs.QueueAttributeNameApproximateNumberOfMessages: "1",
+				}),
+			}, nil
+		},
+	}
+
+	c := NewCollector(client, []string{"foo"}, WithCollectorInterval(time.Millisecond))
+
+	errC := make(chan error)
+	go func() {
+		errC <- c.Run(ctx)
+	}()
+
+	for atomic.LoadInt32(&calls) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Contains(t, metricproducer.GlobalManager().GetAll(), c)
+	assert.Equal(t, map[string]int64{"foo": 1}, gaugeValues(t, c, MessagesVisibleGauge))
+
+	cancel()
+
+	select {
+	case err := <-errC:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("collector did not stop")
+	}
+
+	assert.NotContains(t, metricproducer.GlobalManager().GetAll(), c)
+}
@@ -0,0 +1,421 @@
+package ocsqs
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.krak3n.codes/ocaws"
+)
+
+// Consumer defaults
+const (
+	DefaultConcurrency         = 10
+	DefaultMaxNumberOfMessages = 10
+	DefaultWaitTimeSeconds     = 20
+
+	// DefaultReceiveRetryBaseDelay and DefaultReceiveRetryMaxDelay are the
+	// delays between retrying receive calls which failed with a transient
+	// error
+	DefaultReceiveRetryBaseDelay = 100 * time.Millisecond
+	DefaultReceiveRetryMaxDelay  = 20 * time.Second
+)
+
+// A Handler handles a message received by a Consumer, the message is deleted
+// from the queue if the handler returns nil, otherwise the message will be
+// received again once its visibility timeout expires
+type Handler func(context.Context, *sqs.Message) error
+
+// A ConsumerOption customizes a Consumer
+type ConsumerOption func(*Consumer)
+
+// WithConcurrency sets the maximum number of messages handled concurrently
+func WithConcurrency(n int) ConsumerOption {
+	return ConsumerOption(func(c *Consumer) {
+		c.concurrency = n
+	})
+}
+
+// WithMaxNumberOfMessages sets the maximum number of messages received in a
+// single receive call, SQS allows between 1 and 10
+func WithMaxNumberOfMessages(n int64) ConsumerOption {
+	return ConsumerOption(func(c *Consumer) {
+		c.maxNumberOfMessages = n
+	})
+}
+
+// WithWaitTimeSeconds sets how long a receive call long polls for messages,
+// SQS allows up to 20 seconds
+func WithWaitTimeSeconds(n int64) ConsumerOption {
+	return ConsumerOption(func(c *Consumer) {
+		c.waitTimeSeconds = n
+	})
+}
+
+// WithVisibilityTimeout sets the visibility timeout of received messages in
+// seconds, by default the queues visibility timeout is used
+func WithVisibilityTimeout(n int64) ConsumerOption {
+	return ConsumerOption(func(c *Consumer) {
+		c.visibilityTimeout = aws.Int64(n)
+	})
+}
+
+// WithTraceOptions sets the options used to start spans for each message
+func WithTraceOptions(opts ...Option) ConsumerOption {
+	return ConsumerOption(func(c *Consumer) {
+		c.options = opts
+	})
+}
+
+// WithHeartbeat extends the visibility timeout of each message while it is
+// being handled, see StartHeartbeat
+func WithHeartbeat(opts ...HeartbeatOption) ConsumerOption {
+	return ConsumerOption(func(c *Consumer) {
+		c.heartbeat = true
+		c.heartbeatOptions = opts
+	})
+}
+
+// WithAcknowledger deletes handled messages in batches using the given
+// Acknowledger rather than deleting each message individually. The
+// Acknowledger is not closed by the Consumer.
+func WithAcknowledger(a *Acknowledger) ConsumerOption {
+	return ConsumerOption(func(c *Consumer) {
+		c.acknowledger = a
+	})
+}
+
+// WithRetryPolicy delays the next attempt of messages which failed to be
+// handled according to the retry policy, by default failed messages are
+// received again once their visibility timeout expires
+func WithRetryPolicy(p *RetryPolicy) ConsumerOption {
+	return ConsumerOption(func(c *Consumer) {
+		c.retryPolicy = p
+	})
+}
+
+// WithReceiveRetryPolicy sets the backoff between retrying receive calls which
+// failed with a transient error such as throttling or a network error, the
+// attempts are not limited. A nil policy is ignored.
+func WithReceiveRetryPolicy(p *RetryPolicy) ConsumerOption {
+	return ConsumerOption(func(c *Consumer) {
+		if p != nil {
+			c.receiveRetryPolicy = p
+		}
+	})
+}
+
+// WithMiddleware wraps the handler given to Consume in the middleware, see
+// Chain. The middleware is called within the span started for each message.
+func WithMiddleware(mws ...Middleware) ConsumerOption {
+	return ConsumerOption(func(c *Consumer) {
+		c.middleware = append(c.middleware, mws...)
+	})
+}
+
+// A Consumer receives messages from an SQS queue and passes them to a Handler
+// using a pool of goroutines. A span is started for each message from the
+// span context propagated on the message.
+type Consumer struct {
+	client              sqsiface.SQSAPI
+	queueURL            string
+	concurrency         int
+	maxNumberOfMessages int64
+	waitTimeSeconds     int64
+	visibilityTimeout   *int64
+	options             []Option
+	heartbeat           bool
+	heartbeatOptions    []HeartbeatOption
+	acknowledger        *Acknowledger
+	retryPolicy         *RetryPolicy
+	receiveRetryPolicy  *RetryPolicy
+	middleware          []Middleware
+}
+
+// NewConsumer constructs a new Consumer for the given queue. Use
+// ConsumerOption functions to customise configuration. By default up to 10
+// messages are handled concurrently and receive calls long poll for 20
+// seconds.
+func NewConsumer(client sqsiface.SQSAPI, queueURL string, opts ...ConsumerOption) *Consumer {
+	c := &Consumer{
+		client:              client,
+		queueURL:            queueURL,
+		concurrency:         DefaultConcurrency,
+		maxNumberOfMessages: DefaultMaxNumberOfMessages,
+		waitTimeSeconds:     DefaultWaitTimeSeconds,
+		receiveRetryPolicy: &RetryPolicy{
+			BaseDelay: DefaultReceiveRetryBaseDelay,
+			MaxDelay:  DefaultReceiveRetryMaxDelay,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.concurrency < 1 {
+		c.concurrency = 1
+	}
+
+	return c
+}
+
+// Consume receives messages from the queue passing each message to the
+// handler until the context is done or receiving messages fails with an error
+// which cannot be retried. Messages are only received once a handler is free
+// to handle them so they do not wait out their visibility timeout in memory.
+// Receive calls which fail with a transient error are retried with backoff,
+// see WithReceiveRetryPolicy. Messages which have been received are still
+// handled once the context is done, Consume waits for these to be handled
+// before returning. Handlers are given a context which is not cancelled with
+// the given context. Consume returns nil once the context is done.
+func (c *Consumer) Consume(ctx context.Context, handler Handler) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	semC := make(chan struct{}, c.concurrency)
+	hctx := detachedContext{ctx}
+
+	handler = Chain(handler, c.middleware...)
+
+	var attempt int64
+	for {
+		n := c.acquire(ctx, semC)
+		if n == 0 {
+			return nil
+		}
+
+		out, err := c.client.ReceiveMessageWithContext(ctx, c.receiveMessageInput(n))
+		if err != nil {
+			release(semC, n)
+
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			if !isRetryableReceiveError(err) {
+				return err
+			}
+
+			attempt++
+			if !sleep(ctx, c.receiveRetryPolicy.Backoff(attempt)) {
+				return nil
+			}
+
+			continue
+		}
+
+		attempt = 0
+
+		record(ctx, c.queueURL, ocaws.OutcomeOK, MessagesReceived.M(int64(len(out.Messages))))
+
+		for i, msg := range out.Messages {
+			if i >= n {
+				// More messages than requested, wait for a free handler
+				semC <- struct{}{}
+			}
+
+			wg.Add(1)
+
+			go func(msg *sqs.Message) {
+				defer func() {
+					<-semC
+					wg.Done()
+				}()
+
+				c.handle(hctx, handler, msg)
+			}(msg)
+		}
+
+		release(semC, n-len(out.Messages))
+	}
+}
+
+// acquire blocks until at least one handler is free and then takes as many
+// free handlers as can be received in a single receive call, returning the
+// number taken. Zero is returned if the context is done.
+func (c *Consumer) acquire(ctx context.Context, semC chan struct{}) int {
+	select {
+	case <-ctx.Done():
+		return 0
+	case semC <- struct{}{}:
+	}
+
+	n := 1
+	for int64(n) < c.maxNumberOfMessages {
+		select {
+		case semC <- struct{}{}:
+			n++
+		default:
+			return n
+		}
+	}
+
+	return n
+}
+
+// release frees n handlers, nothing is freed if n is not positive
+func release(semC chan struct{}, n int) {
+	for i := 0; i < n; i++ {
+		<-semC
+	}
+}
+
+// receiveMessageInput returns the input for receiving messages, never
+// receiving more messages than there are free handlers
+func (c *Consumer) receiveMessageInput(free int) *sqs.ReceiveMessageInput {
+	max := c.maxNumberOfMessages
+	if n := int64(free); n < max {
+		max = n
+	}
+
+	return ReceiveMessageInputWithAttributeNames(&sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(c.queueURL),
+		MaxNumberOfMessages: aws.Int64(max),
+		WaitTimeSeconds:     aws.Int64(c.waitTimeSeconds),
+		VisibilityTimeout:   c.visibilityTimeout,
+	})
+}
+
+// isRetryableReceiveError returns true if a receive call failed with a
+// transient error such as throttling, a network error or a server error
+func isRetryableReceiveError(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+
+	if request.IsErrorRetryable(aerr) || request.IsErrorThrottle(aerr) {
+		return true
+	}
+
+	if rerr, ok := aerr.(awserr.RequestFailure); ok {
+		return rerr.StatusCode() >= http.StatusInternalServerError
+	}
+
+	return false
+}
+
+// sleep waits for the duration returning false if the context is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// handle starts a span for the message and passes it to the handler, deleting
+// the message if the handler succeeds. Panics are recorded on the span before
+// re-panicking, use RecoverMiddleware to retry the message instead.
+func (c *Consumer) handle(ctx context.Context, handler Handler, msg *sqs.Message) {
+	start := time.Now()
+
+	// The message is decoded once for its span and latency, the handler is
+	// given the message as it was received
+	o := c.traceOptions()
+	decoded, n := decodeMessage(msg, o.EnvelopeMode)
+
+	ctx, span := startMessageSpan(ctx, decoded, n, o)
+	defer func() {
+		if v := recover(); v != nil {
+			endSpanWithPanic(span, v)
+			recordProcess(ctx, c.queueURL, start, &PanicError{Value: v})
+			panic(v)
+		}
+
+		span.End()
+	}()
+
+	if c.retryPolicy != nil {
+		c.retryPolicy.Annotate(span, msg)
+	}
+
+	recordLatency(ctx, c.queueURL, decoded, n, start)
+
+	msg, err := loadMessageBody(ctx, msg, n, o)
+	if err != nil {
+		// The message will be received again once its visibility timeout
+		// expires
+		span.SetStatus(ocaws.TraceStatus(err))
+		recordProcess(ctx, c.queueURL, start, err)
+
+		return
+	}
+
+	var hb *Heartbeat
+	if c.heartbeat {
+		hb = StartHeartbeat(ctx, c.client, c.queueURL, msg, c.heartbeatOptions...)
+
+		// Stop the heartbeat if the handler panics, it is stopped as soon as
+		// the handler returns otherwise
+		defer hb.Stop()
+	}
+
+	err = handler(ctx, msg)
+
+	if hb != nil {
+		hb.Stop()
+	}
+
+	recordProcess(ctx, c.queueURL, start, err)
+
+	if err != nil {
+		span.SetStatus(spanStatus(err))
+
+		if c.retryPolicy != nil {
+			// The outcome is annotated on the span by the retry policy
+			c.retryPolicy.Retry(ctx, c.client, c.queueURL, msg)
+		}
+
+		return
+	}
+
+	if c.acknowledger != nil {
+		// The outcome is annotated on the span by the acknowledger
+		c.acknowledger.Ack(ctx, msg)
+		return
+	}
+
+	_, err = c.client.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(c.queueURL),
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	record(ctx, c.queueURL, ocaws.Outcome(err), MessagesDeleted.M(1))
+
+	if err != nil {
+		span.Annotate(nil, "Failed to delete message: "+err.Error())
+	}
+}
+
+// traceOptions returns the options configured by WithTraceOptions
+func (c *Consumer) traceOptions() *Options {
+	o := DefaultOptions()
+	for _, opt := range c.options {
+		opt(o)
+	}
+
+	return o
+}
+
+// detachedContext carries the values of its parent context without its
+// deadline or cancellation, allowing in flight messages to be handled after
+// the consumers context is done
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
@@ -0,0 +1,383 @@
+package ocsqs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.krak3n.codes/ocaws/offload"
+)
+
+func TestNewConsumer(t *testing.T) {
+	type TestCase struct {
+		tName    string
+		opts     []ConsumerOption
+		consumer *Consumer
+	}
+	tt := []TestCase{
+		{
+			tName: "defaults",
+			consumer: &Consumer{
+				queueURL:            "foo",
+				concurrency:         DefaultConcurrency,
+				maxNumberOfMessages: DefaultMaxNumberOfMessages,
+				waitTimeSeconds:     DefaultWaitTimeSeconds,
+				receiveRetryPolicy: &RetryPolicy{
+					BaseDelay: DefaultReceiveRetryBaseDelay,
+					MaxDelay:  DefaultReceiveRetryMaxDelay,
+				},
+			},
+		},
+		{
+			tName: "with options",
+			opts: []ConsumerOption{
+				WithConcurrency(0),
+				WithMaxNumberOfMessages(5),
+				WithWaitTimeSeconds(10),
+				WithVisibilityTimeout(30),
+				WithReceiveRetryPolicy(&RetryPolicy{BaseDelay: time.Second}),
+			},
+			consumer: &Consumer{
+				queueURL:            "foo",
+				concurrency:         1,
+				maxNumberOfMessages: 5,
+				waitTimeSeconds:     10,
+				visibilityTimeout:   aws.Int64(30),
+				receiveRetryPolicy:  &RetryPolicy{BaseDelay: time.Second},
+			},
+		},
+		{
+			tName: "nil receive retry policy",
+			opts: []ConsumerOption{
+				WithReceiveRetryPolicy(nil),
+			},
+			consumer: &Consumer{
+				queueURL:            "foo",
+				concurrency:         DefaultConcurrency,
+				maxNumberOfMessages: DefaultMaxNumberOfMessages,
+				waitTimeSeconds:     DefaultWaitTimeSeconds,
+				receiveRetryPolicy: &RetryPolicy{
+					BaseDelay: DefaultReceiveRetryBaseDelay,
+					MaxDelay:  DefaultReceiveRetryMaxDelay,
+				},
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.consumer, NewConsumer(nil, "foo", tc.opts...))
+		})
+	}
+}
+
+func TestConsumer_Consume(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mtx     sync.Mutex
+		deleted []string
+		calls   int32
+	)
+
+	client := &TestSQS{
+		ReceiveMessageWithContextFunc: func(ctx aws.Context, in *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+			assert.Equal(t, int64(DefaultWaitTimeSeconds), aws.Int64Value(in.WaitTimeSeconds))
+
+			if atomic.AddInt32(&calls, 1) > 1 {
+				// Simulate a long poll which is interrupted by shutdown
+				cancel()
+				<-ctx.Done()
+
+				return nil, ctx.Err()
+			}
+
+			assert.Equal(t, int64(2), aws.Int64Value(in.MaxNumberOfMessages))
+
+			return &sqs.ReceiveMessageOutput{
+				Messages: []*sqs.Message{
+					{MessageId: aws.String("ok"), ReceiptHandle: aws.String("ok")},
+					{MessageId: aws.String("fail"), ReceiptHandle: aws.String("fail")},
+				},
+			}, nil
+		},
+		DeleteMessageWithContextFunc: func(ctx aws.Context, in *sqs.DeleteMessageInput, opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+			assert.Equal(t, "foo", aws.StringValue(in.QueueUrl))
+
+			mtx.Lock()
+			defer mtx.Unlock()
+
+			deleted = append(deleted, aws.StringValue(in.ReceiptHandle))
+
+			return &sqs.DeleteMessageOutput{}, nil
+		},
+	}
+
+	var handled int32
+
+	err := NewConsumer(client, "foo", WithConcurrency(2)).Consume(ctx, func(ctx context.Context, msg *sqs.Message) error {
+		atomic.AddInt32(&handled, 1)
+		assert.NoError(t, ctx.Err())
+
+		if aws.StringValue(msg.MessageId) == "fail" {
+			return errors.New("boom")
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&handled))
+	assert.Equal(t, []string{"ok"}, deleted)
+}
+
+func TestConsumer_Consume_freeHandlers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var calls int32
+	receivedC := make(chan struct{})
+
+	client := &TestSQS{
+		ReceiveMessageWithContextFunc: func(ctx aws.Context, in *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+			switch atomic.AddInt32(&calls, 1) {
+			case 1:
+				assert.Equal(t, int64(2), aws.Int64Value(in.MaxNumberOfMessages))
+
+				return &sqs.ReceiveMessageOutput{
+					Messages: []*sqs.Message{
+						{MessageId: aws.String("fast"), ReceiptHandle: aws.String("fast")},
+						{MessageId: aws.String("slow"), ReceiptHandle: aws.String("slow")},
+					},
+				}, nil
+			case 2:
+				// Only the fast handler has finished
+				assert.Equal(t, int64(1), aws.Int64Value(in.MaxNumberOfMessages))
+				close(receivedC)
+			}
+
+			cancel()
+
+			return nil, ctx.Err()
+		},
+		DeleteMessageWithContextFunc: func(ctx aws.Context, in *sqs.DeleteMessageInput, opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+			return &sqs.DeleteMessageOutput{}, nil
+		},
+	}
+
+	err := NewConsumer(client, "foo", WithConcurrency(2)).Consume(ctx, func(ctx context.Context, msg *sqs.Message) error {
+		if aws.StringValue(msg.MessageId) == "slow" {
+			<-receivedC
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestConsumer_Consume_receiveError(t *testing.T) {
+	type TestCase struct {
+		tName string
+		errs  []error
+		err   error
+		calls int32
+	}
+	tt := []TestCase{
+		{
+			tName: "error",
+			errs:  []error{errors.New("boom")},
+			err:   errors.New("boom"),
+			calls: 1,
+		},
+		{
+			tName: "queue does not exist",
+			errs:  []error{awserr.New(sqs.ErrCodeQueueDoesNotExist, "boom", nil)},
+			err:   awserr.New(sqs.ErrCodeQueueDoesNotExist, "boom", nil),
+			calls: 1,
+		},
+		{
+			tName: "retries transient errors",
+			errs: []error{
+				awserr.New("ThrottlingException", "boom", nil),
+				awserr.NewRequestFailure(awserr.New("InternalError", "boom", nil), http.StatusInternalServerError, "foo"),
+				awserr.New("RequestError", "boom", errors.New("connection reset")),
+				errors.New("boom"),
+			},
+			err:   errors.New("boom"),
+			calls: 4,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			var calls int32
+
+			client := &TestSQS{
+				ReceiveMessageWithContextFunc: func(ctx aws.Context, in *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+					return nil, tc.errs[atomic.AddInt32(&calls, 1)-1]
+				},
+			}
+
+			consumer := NewConsumer(client, "foo", WithReceiveRetryPolicy(&RetryPolicy{
+				BaseDelay: time.Millisecond,
+				MaxDelay:  time.Millisecond,
+			}))
+
+			err := consumer.Consume(context.Background(), func(context.Context, *sqs.Message) error {
+				return nil
+			})
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.calls, atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+func TestConsumer_Consume_receiveRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	client := &TestSQS{
+		ReceiveMessageWithContextFunc: func(ctx aws.Context, in *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+			cancel()
+			return nil, awserr.New("ThrottlingException", "boom", nil)
+		},
+	}
+
+	consumer := NewConsumer(client, "foo", WithReceiveRetryPolicy(&RetryPolicy{
+		BaseDelay: time.Hour,
+		MaxDelay:  time.Hour,
+	}))
+
+	err := consumer.Consume(ctx, func(context.Context, *sqs.Message) error {
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestConsumer_handle_heartbeatPanic(t *testing.T) {
+	var calls int32
+
+	client := &TestSQS{
+		ChangeMessageVisibilityWithContextFunc: func(ctx aws.Context, in *sqs.ChangeMessageVisibilityInput, opts ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+			atomic.AddInt32(&calls, 1)
+			return &sqs.ChangeMessageVisibilityOutput{}, nil
+		},
+	}
+
+	consumer := NewConsumer(client, "foo", WithHeartbeat(WithHeartbeatInterval(time.Millisecond)))
+
+	func() {
+		defer func() {
+			assert.Equal(t, "boom", recover())
+		}()
+
+		consumer.handle(context.Background(), func(context.Context, *sqs.Message) error {
+			time.Sleep(10 * time.Millisecond)
+			panic("boom")
+		}, &sqs.Message{ReceiptHandle: aws.String("foo")})
+	}()
+
+	// The heartbeat is stopped before the panic leaves handle
+	n := atomic.LoadInt32(&calls)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadInt32(&calls))
+}
+
+func TestConsumer_Consume_offload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mtx     sync.Mutex
+		deleted []string
+		calls   int32
+	)
+
+	// A message published through SNS without raw message delivery
+	envelope := `{"Message":"[\"software.amazon.payloadoffloading.PayloadS3Pointer\",{\"s3BucketName\":\"foo\",\"s3Key\":\"ok\"}]","Type":"Notification"}`
+
+	client := &TestSQS{
+		ReceiveMessageWithContextFunc: func(ctx aws.Context, in *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+			if atomic.AddInt32(&calls, 1) > 1 {
+				cancel()
+				<-ctx.Done()
+
+				return nil, ctx.Err()
+			}
+
+			return &sqs.ReceiveMessageOutput{
+				Messages: []*sqs.Message{
+					{
+						MessageId:     aws.String("ok"),
+						ReceiptHandle: aws.String("ok"),
+						Body:          aws.String(offload.Pointer{Bucket: "foo", Key: "ok"}.String()),
+					},
+					{
+						MessageId:     aws.String("missing"),
+						ReceiptHandle: aws.String("missing"),
+						Body:          aws.String(offload.Pointer{Bucket: "foo", Key: "missing"}.String()),
+					},
+					{
+						MessageId:     aws.String("envelope"),
+						ReceiptHandle: aws.String("envelope"),
+						Body:          aws.String(envelope),
+					},
+				},
+			}, nil
+		},
+		DeleteMessageWithContextFunc: func(ctx aws.Context, in *sqs.DeleteMessageInput, opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+
+			deleted = append(deleted, aws.StringValue(in.ReceiptHandle))
+
+			return &sqs.DeleteMessageOutput{}, nil
+		},
+	}
+
+	off := offload.New(&TestS3{
+		GetObjectWithContextFunc: func(ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+			if aws.StringValue(in.Key) == "missing" {
+				return nil, errors.New("boom")
+			}
+
+			return &s3.GetObjectOutput{
+				Body: ioutil.NopCloser(strings.NewReader("bar")),
+			}, nil
+		},
+	}, "foo")
+
+	var bodies []string
+
+	err := NewConsumer(client, "foo", WithConcurrency(1), WithTraceOptions(WithOffloader(off))).Consume(ctx, func(ctx context.Context, msg *sqs.Message) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		bodies = append(bodies, aws.StringValue(msg.Body))
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"bar", `{"Message":"bar","Type":"Notification"}`}, bodies)
+	assert.ElementsMatch(t, []string{"ok", "envelope"}, deleted)
+}
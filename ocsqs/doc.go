@@ -7,13 +7,20 @@ attributes.
 
 Raw Message Delivery
 
-SNS allows you to create subscriptions with RawMessageDelivery enabled. If you
-have connected your SQS queue to an SNS topic with RawMessageDelivery you must
-create the ocsqs.SQS client also with RawMessageDelivery enabled as this affects
-how span contexts are retrieved from message attributes.
+SNS allows you to create subscriptions with RawMessageDelivery enabled. This
+affects how span contexts are retrieved from message attributes, without raw
+message delivery the message attributes are held in the SNS envelope in the
+message body. By default the client will use the SQS message attributes if the
+message has any, otherwise the body is decoded as an SNS envelope. You can be
+explicit about how messages are decoded:
 
     client := ocsqs.New(sqs.New(session), ocsqs.WithRawMessageDelivery())
 
+Or for SNS subscriptions without raw message delivery, where the SNS envelope
+attributes are merged with any SQS message attributes:
+
+    client := ocsqs.New(sqs.New(session), ocsqs.WithSNSEnvelope())
+
 Rember to set the MessageAttributeNames field on ReceiveMessageInput to All
 to ensure message attributes are added to the message:
 
@@ -22,5 +29,203 @@ to ensure message attributes are added to the message:
         MessageAttributeNames: []*string{aws.String("All")},
     })
 
+The ocsqs.SQS client ReceiveMessageWithContext method will do this for you.
+ReceiveTracedMessagesWithContext will also pair each received message with a
+context holding the span context propagated on the message:
+
+    msgs, err := client.ReceiveTracedMessagesWithContext(ctx, &sqs.ReceiveMessageInput{
+        QueueUrl: aws.String("your-queue-url"),
+    })
+
+
+Producer
+
+A Producer collects messages sent from many goroutines and sends them with
+SendMessageBatch once it has 10 messages or after a short linger time. Up to 4
+batches are sent at once by default, see WithMaxInFlight. Batches to FIFO queues
+are sent one at a time so messages in the same group keep their order. Each
+message is given a client span started from the context it was sent with and
+the result of sending each message is returned through a SendFuture:
+
+    producer := ocsqs.NewProducer(client, "your-queue-url")
+    defer producer.Close()
+
+    out, err := producer.Send(ctx, &sqs.SendMessageBatchRequestEntry{
+        MessageBody: aws.String("foo"),
+    }).Wait(ctx)
+
+
+Consumer
+
+A Consumer receives messages from a queue and passes each message to a Handler
+in its own goroutine with a span started from the propagated span context.
+Receive calls long poll for no more messages than there are free handlers and
+messages are only deleted once the handler returns nil. Receive calls which
+fail with throttling, network or server errors are retried with backoff. Cancel
+the context to stop receiving, Consume returns once the messages in flight have
+been handled:
+
+    consumer := ocsqs.NewConsumer(client, "your-queue-url", ocsqs.WithConcurrency(5))
+
+    err := consumer.Consume(ctx, func(ctx context.Context, msg *sqs.Message) error {
+        // Do work
+        return nil
+    })
+
+
+Middleware
+
+Handlers can be wrapped in Middleware to add behaviour such as logging,
+metrics or deadlines around handling each message. Chain composes middleware
+around a handler, the Consumer applies middleware given with WithMiddleware
+within the span started for each message:
+
+    consumer := ocsqs.NewConsumer(client, "your-queue-url", ocsqs.WithMiddleware(logging, metrics))
+
+TracingMiddleware starts a span for each message using StartSpan, use this
+when handling messages received by your own receive loop:
+
+    handler = ocsqs.Chain(handler, ocsqs.TracingMiddleware(), logging)
+
+Spans are given a status from the error returned by the handler, AWS error
+codes are mapped to OpenCensus canonical codes by ocaws.TraceStatus. Use
+EndSpan to do the same for spans started with StartSpan:
+
+    ctx, span := ocsqs.StartSpan(ctx, msg)
+    err := handle(ctx, msg)
+    ocsqs.EndSpan(span, err)
+
+Handlers which panic have their span marked as an internal error before
+re-panicking. RecoverMiddleware instead returns a *PanicError so the message is
+retried, place it after tracing so the panic is recorded on the span:
+
+    consumer := ocsqs.NewConsumer(client, "your-queue-url", ocsqs.WithMiddleware(ocsqs.RecoverMiddleware()))
+
+
+Heartbeats
+
+Messages which take longer to handle than the queues visibility timeout are
+received again while still being handled. A Heartbeat extends the visibility
+timeout of a message periodically until it is stopped, annotating the span in
+the given context with each extension:
+
+    ctx, span := ocsqs.StartSpan(ctx, msg)
+    defer span.End()
+
+    hb := ocsqs.StartHeartbeat(ctx, client, "your-queue-url", msg)
+    defer hb.Stop()
+
+Consumers can start a heartbeat for every message with the WithHeartbeat
+option.
+
+
+Batch Acknowledgement
+
+Deleting each message individually doubles the number of API calls made. An
+Acknowledger collects messages and deletes them with DeleteMessageBatch once
+it has 10 messages or after a short interval, entries which fail are retried
+individually and the outcome annotated on the span in the given context:
+
+    ack := ocsqs.NewAcknowledger(client, "your-queue-url")
+    defer ack.Close()
+
+    consumer := ocsqs.NewConsumer(client, "your-queue-url", ocsqs.WithAcknowledger(ack))
+
+
+Retries
+
+By default messages which fail to be handled are received again once their
+visibility timeout expires. A RetryPolicy delays the next attempt using
+exponential backoff with jitter based on the ApproximateReceiveCount of the
+message, set MaxAttempts to the maxReceiveCount of the queues redrive policy
+so the final attempt is annotated on the span:
+
+    policy := ocsqs.DefaultRetryPolicy()
+    policy.MaxAttempts = 5
+
+    consumer := ocsqs.NewConsumer(client, "your-queue-url", ocsqs.WithRetryPolicy(policy))
+
+
+AWS Trace Header
+
+SQS messages can carry an AWSTraceHeader message system attribute which does
+not count towards the limit of 10 message attributes and is understood by
+Lambda and X-Ray. Use the WithAWSTraceHeader option to propagate span contexts
+through the AWSTraceHeader system attribute instead of message attributes:
+
+    client := ocsqs.New(sqs.New(session), ocsqs.WithAWSTraceHeader())
+
+
+Linked Spans
+
+Messages can wait on a queue for a long time before being processed which can
+make the trace of the producer very large. Use the WithLinkedSpans option to
+start a new root span linked to the propagated span context instead:
+
+    ctx, span := ocsqs.StartSpan(ctx, msg, ocsqs.WithLinkedSpans())
+
+
+Message Size
+
+The size of each message is recorded on the span, use WithOversizePolicy to
+set the ocaws.OversizePolicy applied to messages larger than 256 KB:
+
+    client := ocsqs.New(sqs.New(session), ocsqs.WithOversizePolicy(ocaws.DropTraceAttributes))
+
+
+Large Messages
+
+Messages which are too large can have their bodies stored in S3 using an
+offload.Offloader, a pointer to the object is sent instead. The upload is a
+child span of the send span. Consumers configured with the same Offloader
+download the body before calling the handler as a child span of the messages
+span, messages whose body cannot be downloaded are not handled or deleted.
+Messages published through SNS without raw message delivery keep their SNS
+envelope with the pointer in it replaced by the body.
+
+    off := offload.New(s3.New(session), "bucket")
+    client := ocsqs.New(sqs.New(session), ocsqs.WithOffloader(off))
+    consumer := ocsqs.NewConsumer(client, queueURL, ocsqs.WithTraceOptions(ocsqs.WithOffloader(off)))
+
+Use LoadMessageBody when receiving messages without a Consumer.
+
+
+Message Latency
+
+StartSpan records the dwell time and end to end latency of a message on its
+span in milliseconds. Dwell time runs from the SentTimestamp system attribute
+to the ApproximateFirstReceiveTimestamp system attribute. End to end latency
+runs from the time the producer sent the message, read from the
+Trace-Sent-Timestamp message attribute ocsns adds when publishing, then the
+SNS envelope timestamp and then the SentTimestamp system attribute. The SNS
+envelope is only decoded in SNSEnvelope mode, or in AutoEnvelope mode when the
+message has no message attributes. Use ReceiveMessageInputWithAttributeNames so
+these attributes are received.
+
+
+Stats
+
+The SQS client, Producer, Consumer and Acknowledger record OpenCensus stats for
+messages sent, received, processed, failed and deleted along with send and
+handler latencies, tagged by queue name and outcome. The Consumer also records
+the dwell time, the time between a message being sent and first received, and
+the end to end latency, the time between a message being sent and the handler
+being called. Register DefaultViews to export them:
+
+    if err := view.Register(ocsqs.DefaultViews...); err != nil {
+        log.Fatal(err)
+    }
+
+
+Queue Depth
+
+A Collector periodically calls GetQueueAttributes for a set of queues and
+exports the approximate number of visible, in flight and delayed messages as
+OpenCensus gauges labelled with the queue name. Run registers the Collector
+with the global metric producer manager until the context is done:
+
+    collector := ocsqs.NewCollector(client, []string{queueURL}, ocsqs.WithCollectorInterval(30*time.Second))
+    go collector.Run(ctx)
+
 */
 package ocsqs // import "go.krak3n.codes/ocaws/ocsqs"
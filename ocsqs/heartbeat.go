@@ -0,0 +1,136 @@
+package ocsqs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.opencensus.io/trace"
+)
+
+// Heartbeat defaults
+const (
+	DefaultHeartbeatInterval          = 10 * time.Second
+	DefaultHeartbeatVisibilityTimeout = 30
+)
+
+// A HeartbeatOption customizes a Heartbeat
+type HeartbeatOption func(*Heartbeat)
+
+// WithHeartbeatInterval sets how often the visibility timeout is extended, this
+// should be less than the visibility timeout. Intervals less than or equal to
+// zero use DefaultHeartbeatInterval.
+func WithHeartbeatInterval(d time.Duration) HeartbeatOption {
+	return HeartbeatOption(func(h *Heartbeat) {
+		h.interval = d
+	})
+}
+
+// WithHeartbeatVisibilityTimeout sets the visibility timeout in seconds the
+// message is given on each heartbeat
+func WithHeartbeatVisibilityTimeout(n int64) HeartbeatOption {
+	return HeartbeatOption(func(h *Heartbeat) {
+		h.visibilityTimeout = n
+	})
+}
+
+// A Heartbeat periodically extends the visibility timeout of a message while
+// it is being handled, preventing the message being received again before the
+// handler completes. Each extension is recorded as an annotation on the span
+// in the context the heartbeat was started with.
+type Heartbeat struct {
+	client            sqsiface.SQSAPI
+	queueURL          string
+	msg               *sqs.Message
+	interval          time.Duration
+	visibilityTimeout int64
+
+	stopC chan struct{}
+	once  sync.Once
+	wg    sync.WaitGroup
+}
+
+// StartHeartbeat starts extending the visibility timeout of the message until
+// Stop is called or the context is done. Use the context returned by
+// StartSpan so extensions are annotated on the messages span.
+func StartHeartbeat(ctx context.Context, client sqsiface.SQSAPI, queueURL string, msg *sqs.Message, opts ...HeartbeatOption) *Heartbeat {
+	h := &Heartbeat{
+		client:            client,
+		queueURL:          queueURL,
+		msg:               msg,
+		interval:          DefaultHeartbeatInterval,
+		visibilityTimeout: DefaultHeartbeatVisibilityTimeout,
+		stopC:             make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.interval <= 0 {
+		h.interval = DefaultHeartbeatInterval
+	}
+
+	h.wg.Add(1)
+	go h.run(ctx)
+
+	return h
+}
+
+// Stop stops the heartbeat waiting for any extension in progress to complete,
+// it is safe to call Stop more than once
+func (h *Heartbeat) Stop() {
+	h.once.Do(func() {
+		close(h.stopC)
+	})
+
+	h.wg.Wait()
+}
+
+// run extends the visibility timeout on each tick until stopped
+func (h *Heartbeat) run(ctx context.Context) {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stopC:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.extend(ctx)
+		}
+	}
+}
+
+// extend extends the visibility timeout of the message annotating the span in
+// the context with the result
+func (h *Heartbeat) extend(ctx context.Context) {
+	_, err := h.client.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(h.queueURL),
+		ReceiptHandle:     h.msg.ReceiptHandle,
+		VisibilityTimeout: aws.Int64(h.visibilityTimeout),
+	})
+
+	span := trace.FromContext(ctx)
+	if span == nil {
+		return
+	}
+
+	attrs := []trace.Attribute{
+		trace.Int64Attribute(VisibilityTimeoutAttribute, h.visibilityTimeout),
+	}
+
+	if err != nil {
+		span.Annotate(attrs, "Failed to extend message visibility timeout: "+err.Error())
+		return
+	}
+
+	span.Annotate(attrs, "Message visibility timeout extended")
+}
@@ -0,0 +1,107 @@
+package ocsqs
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/trace"
+)
+
+func TestStartHeartbeat(t *testing.T) {
+	type TestCase struct {
+		tName      string
+		err        error
+		annotation string
+	}
+	tt := []TestCase{
+		{
+			tName:      "extended",
+			annotation: "Message visibility timeout extended",
+		},
+		{
+			tName:      "error",
+			err:        errors.New("boom"),
+			annotation: "Failed to extend message visibility timeout: boom",
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			var calls int32
+
+			client := &TestSQS{
+				ChangeMessageVisibilityWithContextFunc: func(ctx aws.Context, in *sqs.ChangeMessageVisibilityInput, opts ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+					assert.Equal(t, "foo", aws.StringValue(in.QueueUrl))
+					assert.Equal(t, "bar", aws.StringValue(in.ReceiptHandle))
+					assert.Equal(t, int64(60), aws.Int64Value(in.VisibilityTimeout))
+
+					atomic.AddInt32(&calls, 1)
+
+					return &sqs.ChangeMessageVisibilityOutput{}, tc.err
+				},
+			}
+
+			ctx, span := trace.StartSpan(context.Background(), t.Name(), trace.WithSampler(trace.AlwaysSample()))
+
+			hb := StartHeartbeat(ctx, client, "foo", &sqs.Message{ReceiptHandle: aws.String("bar")},
+				WithHeartbeatInterval(time.Millisecond),
+				WithHeartbeatVisibilityTimeout(60))
+
+			for atomic.LoadInt32(&calls) < 2 {
+				time.Sleep(time.Millisecond)
+			}
+
+			hb.Stop()
+			hb.Stop()
+
+			n := atomic.LoadInt32(&calls)
+			time.Sleep(5 * time.Millisecond)
+			assert.Equal(t, n, atomic.LoadInt32(&calls), "heartbeat not stopped")
+
+			span.End()
+
+			sd, ok := exporter.Span(t.Name())
+			require.True(t, ok)
+			require.NotEmpty(t, sd.Annotations)
+			assert.Equal(t, tc.annotation, sd.Annotations[0].Message)
+			assert.Equal(t, int64(60), sd.Annotations[0].Attributes[VisibilityTimeoutAttribute])
+		})
+	}
+}
+
+func TestStartHeartbeat_interval(t *testing.T) {
+	type TestCase struct {
+		tName    string
+		interval time.Duration
+	}
+	tt := []TestCase{
+		{
+			tName: "zero",
+		},
+		{
+			tName:    "negative",
+			interval: -time.Second,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			hb := StartHeartbeat(context.Background(), &TestSQS{}, "foo", &sqs.Message{}, WithHeartbeatInterval(tc.interval))
+			hb.Stop()
+
+			assert.Equal(t, DefaultHeartbeatInterval, hb.interval)
+		})
+	}
+}
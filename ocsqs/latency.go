@@ -0,0 +1,149 @@
+package ocsqs
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.krak3n.codes/ocaws"
+	"go.krak3n.codes/ocaws/ocsns"
+	"go.opencensus.io/trace"
+)
+
+// SentTime returns the time the message was sent by its producer. Messages
+// published to SNS are delivered to SQS some time after they were published so
+// the ocaws.TraceSentTimestamp message attribute written by ocsns is
+// preferred, followed by the timestamp of the SNS envelope and then the
+// SentTimestamp system attribute. The SNS envelope is decoded according to the
+// configured EnvelopeMode. False is returned if none are present.
+func SentTime(msg *sqs.Message, opts ...Option) (time.Time, bool) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	msg, n := decodeMessage(msg, o.EnvelopeMode)
+
+	return sentTime(msg, n)
+}
+
+// FirstReceiveTime returns the time the message was first received from the
+// ApproximateFirstReceiveTimestamp system attribute, false is returned if the
+// attribute was not requested when receiving the message
+func FirstReceiveTime(msg *sqs.Message) (time.Time, bool) {
+	return parseTimestamp(msg.Attributes[sqs.MessageSystemAttributeNameApproximateFirstReceiveTimestamp])
+}
+
+// sentTime returns the time the message was sent by its producer from a
+// message decoded by decodeMessage and its SNS envelope, see SentTime
+func sentTime(msg *sqs.Message, n *ocsns.Notification) (time.Time, bool) {
+	if v, ok := msg.MessageAttributes[ocaws.TraceSentTimestamp]; ok {
+		if t, ok := parseTimestamp(v.StringValue); ok {
+			return t, true
+		}
+	}
+
+	if t, ok := envelopeTime(n); ok {
+		return t, true
+	}
+
+	return queueSentTime(msg)
+}
+
+// queueSentTime returns the time the message was sent to the queue from the
+// SentTimestamp system attribute, for messages delivered from SNS this is the
+// time SNS delivered the message
+func queueSentTime(msg *sqs.Message) (time.Time, bool) {
+	return parseTimestamp(msg.Attributes[sqs.MessageSystemAttributeNameSentTimestamp])
+}
+
+// envelopeTime returns the time the message was published to SNS from its SNS
+// envelope, false is returned if the message has no envelope
+func envelopeTime(n *ocsns.Notification) (time.Time, bool) {
+	if n == nil || n.Type != "Notification" || n.Timestamp.IsZero() {
+		return time.Time{}, false
+	}
+
+	return n.Timestamp, true
+}
+
+// messageLatency returns the time the decoded message spent in the queue
+// before it was first received and the time from the message being sent by its
+// producer until now, false is returned for either if the timestamps are not
+// available
+func messageLatency(msg *sqs.Message, n *ocsns.Notification, now time.Time) (dwell time.Duration, dok bool, e2e time.Duration, eok bool) {
+	sent, ok := sentTime(msg, n)
+	if !ok {
+		return 0, false, 0, false
+	}
+
+	queued, ok := queueSentTime(msg)
+	if !ok {
+		queued = sent
+	}
+
+	if received, ok := FirstReceiveTime(msg); ok {
+		dwell, dok = nonNegative(received.Sub(queued)), true
+	}
+
+	return dwell, dok, nonNegative(now.Sub(sent)), true
+}
+
+// latencyAttributes returns span attributes for the dwell time and end to end
+// latency of a message decoded by decodeMessage
+func latencyAttributes(msg *sqs.Message, n *ocsns.Notification, now time.Time) []trace.Attribute {
+	var attrs []trace.Attribute
+
+	dwell, dok, e2e, eok := messageLatency(msg, n, now)
+	if dok {
+		attrs = append(attrs, trace.Int64Attribute(DwellTimeAttribute, milliseconds(dwell)))
+	}
+
+	if eok {
+		attrs = append(attrs, trace.Int64Attribute(EndToEndLatencyAttribute, milliseconds(e2e)))
+	}
+
+	return attrs
+}
+
+// recordLatency records the dwell time and end to end latency of a message
+// decoded by decodeMessage whose processing started at the given time
+func recordLatency(ctx context.Context, queueURL string, msg *sqs.Message, n *ocsns.Notification, start time.Time) {
+	dwell, dok, e2e, eok := messageLatency(msg, n, start)
+	if dok {
+		record(ctx, queueURL, ocaws.OutcomeOK, DwellTime.M(float64(dwell)/float64(time.Millisecond)))
+	}
+
+	if eok {
+		record(ctx, queueURL, ocaws.OutcomeOK, EndToEndLatency.M(float64(e2e)/float64(time.Millisecond)))
+	}
+}
+
+// parseTimestamp parses a timestamp in milliseconds since the epoch
+func parseTimestamp(v *string) (time.Time, bool) {
+	if v == nil {
+		return time.Time{}, false
+	}
+
+	ms, err := strconv.ParseInt(*v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
+
+// nonNegative returns zero for negative durations caused by clock skew
+func nonNegative(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+
+	return d
+}
+
+// milliseconds returns the duration in whole milliseconds
+func milliseconds(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
@@ -0,0 +1,274 @@
+package ocsqs
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.krak3n.codes/ocaws"
+	"go.opencensus.io/trace"
+)
+
+func TestSentTime(t *testing.T) {
+	type TestCase struct {
+		tName string
+		msg   *sqs.Message
+		opts  []Option
+		sent  time.Time
+		ok    bool
+	}
+	tt := []TestCase{
+		{
+			tName: "sent timestamp",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp: aws.String("1000"),
+				},
+			},
+			sent: time.Unix(1, 0),
+			ok:   true,
+		},
+		{
+			tName: "message attribute before sent timestamp",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp: aws.String("1000"),
+				},
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					ocaws.TraceSentTimestamp: &sqs.MessageAttributeValue{
+						DataType:    aws.String("Number"),
+						StringValue: aws.String("500"),
+					},
+				},
+			},
+			sent: time.Unix(0, int64(500*time.Millisecond)),
+			ok:   true,
+		},
+		{
+			tName: "message attribute",
+			msg: &sqs.Message{
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					ocaws.TraceSentTimestamp: &sqs.MessageAttributeValue{
+						DataType:    aws.String("Number"),
+						StringValue: aws.String("500"),
+					},
+				},
+			},
+			sent: time.Unix(0, int64(500*time.Millisecond)),
+			ok:   true,
+		},
+		{
+			tName: "sns envelope",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp: aws.String("5000"),
+				},
+				Body: aws.String(`{"Type":"Notification","Timestamp":"1970-01-01T00:00:03Z","MessageAttributes":{"Trace-Sent-Timestamp":{"Type":"Number","Value":"2000"}}}`),
+			},
+			opts: []Option{WithSNSEnvelope()},
+			sent: time.Unix(2, 0),
+			ok:   true,
+		},
+		{
+			tName: "sns envelope timestamp",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp: aws.String("5000"),
+				},
+				Body: aws.String(`{"Type":"Notification","Timestamp":"1970-01-01T00:00:03Z"}`),
+			},
+			sent: time.Unix(3, 0),
+			ok:   true,
+		},
+		{
+			tName: "raw message delivery ignores body",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp: aws.String("5000"),
+				},
+				Body: aws.String(`{"Type":"Notification","Timestamp":"1970-01-01T00:00:03Z"}`),
+			},
+			opts: []Option{WithRawMessageDelivery()},
+			sent: time.Unix(5, 0),
+			ok:   true,
+		},
+		{
+			tName: "message attributes ignore body",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp: aws.String("5000"),
+				},
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					"Foo": &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String("Bar"),
+					},
+				},
+				Body: aws.String(`{"Type":"Notification","Timestamp":"1970-01-01T00:00:03Z"}`),
+			},
+			sent: time.Unix(5, 0),
+			ok:   true,
+		},
+		{
+			tName: "sns envelope mode with message attributes",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp: aws.String("5000"),
+				},
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					"Foo": &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String("Bar"),
+					},
+				},
+				Body: aws.String(`{"Type":"Notification","Timestamp":"1970-01-01T00:00:03Z"}`),
+			},
+			opts: []Option{WithSNSEnvelope()},
+			sent: time.Unix(3, 0),
+			ok:   true,
+		},
+		{
+			tName: "invalid",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp: aws.String("foo"),
+				},
+			},
+		},
+		{
+			tName: "missing",
+			msg:   &sqs.Message{},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			sent, ok := SentTime(tc.msg, tc.opts...)
+			assert.Equal(t, tc.ok, ok)
+			assert.True(t, tc.sent.Equal(sent), "expected %s got %s", tc.sent, sent)
+		})
+	}
+}
+
+func Test_latencyAttributes(t *testing.T) {
+	now := time.Unix(10, 0)
+
+	type TestCase struct {
+		tName string
+		msg   *sqs.Message
+		attrs []trace.Attribute
+	}
+	tt := []TestCase{
+		{
+			tName: "sent and first received",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp:                    aws.String("1000"),
+					sqs.MessageSystemAttributeNameApproximateFirstReceiveTimestamp: aws.String("4000"),
+				},
+			},
+			attrs: []trace.Attribute{
+				trace.Int64Attribute(DwellTimeAttribute, 3000),
+				trace.Int64Attribute(EndToEndLatencyAttribute, 9000),
+			},
+		},
+		{
+			tName: "sent",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp: aws.String("1000"),
+				},
+			},
+			attrs: []trace.Attribute{
+				trace.Int64Attribute(EndToEndLatencyAttribute, 9000),
+			},
+		},
+		{
+			tName: "clock skew",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp: aws.String("11000"),
+				},
+			},
+			attrs: []trace.Attribute{
+				trace.Int64Attribute(EndToEndLatencyAttribute, 0),
+			},
+		},
+		{
+			tName: "sns envelope",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp:                    aws.String("3000"),
+					sqs.MessageSystemAttributeNameApproximateFirstReceiveTimestamp: aws.String("4000"),
+				},
+				Body: aws.String(`{"Type":"Notification","Timestamp":"1970-01-01T00:00:01Z"}`),
+			},
+			attrs: []trace.Attribute{
+				trace.Int64Attribute(DwellTimeAttribute, 1000),
+				trace.Int64Attribute(EndToEndLatencyAttribute, 9000),
+			},
+		},
+		{
+			tName: "message attributes ignore body",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameSentTimestamp:                    aws.String("3000"),
+					sqs.MessageSystemAttributeNameApproximateFirstReceiveTimestamp: aws.String("4000"),
+				},
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{},
+				Body:              aws.String(`{"Type":"Notification","Timestamp":"1970-01-01T00:00:01Z"}`),
+			},
+			attrs: []trace.Attribute{
+				trace.Int64Attribute(DwellTimeAttribute, 1000),
+				trace.Int64Attribute(EndToEndLatencyAttribute, 7000),
+			},
+		},
+		{
+			tName: "no timestamps",
+			msg:   &sqs.Message{},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			msg, n := decodeMessage(tc.msg, AutoEnvelope)
+			assert.Equal(t, tc.attrs, latencyAttributes(msg, n, now))
+		})
+	}
+}
+
+func TestStartSpan_latency(t *testing.T) {
+	sent := time.Now().Add(-time.Minute)
+
+	_, span := StartSpan(context.Background(), &sqs.Message{
+		MessageId: aws.String(t.Name()),
+		Attributes: map[string]*string{
+			sqs.MessageSystemAttributeNameSentTimestamp:                    aws.String(timestamp(sent)),
+			sqs.MessageSystemAttributeNameApproximateFirstReceiveTimestamp: aws.String(timestamp(sent.Add(time.Second))),
+		},
+	}, WithFormatSpanName(func(*sqs.Message) string {
+		return t.Name()
+	}), WithStartOptions(trace.StartOptions{
+		Sampler: trace.AlwaysSample(),
+	}))
+	span.End()
+
+	sd, ok := exporter.Span(t.Name())
+	require.True(t, ok)
+	assert.Equal(t, int64(1000), sd.Attributes[DwellTimeAttribute])
+	assert.True(t, sd.Attributes[EndToEndLatencyAttribute].(int64) >= int64(60000))
+}
+
+// timestamp formats the time in milliseconds since the epoch
+func timestamp(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
@@ -6,10 +6,13 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/sqs"
 	"go.krak3n.codes/ocaws"
+	"go.krak3n.codes/ocaws/ocsns"
+	"go.krak3n.codes/ocaws/offload"
 	"go.opencensus.io/trace"
 )
 
@@ -27,25 +30,95 @@ func StartSpan(ctx context.Context, msg *sqs.Message, opts ...Option) (context.C
 		opt(o)
 	}
 
-	name := o.FormatSpanName(msg)
-	attrs := GetMessageAttributes(msg)
+	// Decode the message once so its attributes are consistently applied
+	// when formatting span names and getting start options
+	msg, n := decodeMessage(msg, o.EnvelopeMode)
 
-	sctx, ok := o.Propagator.SpanContextFromMessageAttributes(attrs)
-	if !ok {
-		return trace.StartSpan(ctx, name)
-	}
+	return startMessageSpan(ctx, msg, n, o)
+}
+
+// startMessageSpan starts a span from a message decoded by decodeMessage, n is
+// the SNS envelope of the message if it has one
+func startMessageSpan(ctx context.Context, msg *sqs.Message, n *ocsns.Notification, o *Options) (context.Context, *trace.Span) {
+	name := o.FormatSpanName(msg)
 
 	sopts := o.StartOptions
 	if o.GetStartOptions != nil {
 		sopts = o.GetStartOptions(msg)
 	}
 
-	return trace.StartSpanWithRemoteParent(
-		ctx,
-		name,
-		sctx,
-		trace.WithSpanKind(trace.SpanKindServer),
-		trace.WithSampler(sopts.Sampler))
+	sctx, ok := spanContextFromMessage(msg, msg.MessageAttributes, o)
+
+	ctx, span := startSpan(ctx, name, sctx, ok, sopts, o)
+	span.AddAttributes(receivedMessageAttributes(msg)...)
+	span.AddAttributes(latencyAttributes(msg, n, time.Now())...)
+
+	return ctx, span
+}
+
+// StartSpanFromContext starts a span using the span context placed on the
+// context by WithContext as the remote parent, applying the configured start
+// options. GetStartOptions is not used as there is no message available. If
+// the context holds no span context a span is started as normal. The span
+// context is removed from the returned context so further spans are started
+// as children of the returned span.
+func StartSpanFromContext(ctx context.Context, name string, opts ...Option) (context.Context, *trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	sctx, ok := SpanFromContext(ctx)
+	if ok {
+		ctx = context.WithValue(ctx, spanContextKey{}, nil)
+	}
+
+	return startSpan(ctx, name, sctx, ok, o.StartOptions, o)
+}
+
+// startSpan starts a span with the given span context as the remote parent
+// if ok, linking to it instead if configured to do so
+func startSpan(ctx context.Context, name string, sctx trace.SpanContext, ok bool, sopts trace.StartOptions, o *Options) (context.Context, *trace.Span) {
+	if !ok {
+		return trace.StartSpan(ctx, name, startOptions(sopts)...)
+	}
+
+	if o.LinkedSpans {
+		// An empty parent span context always starts a new root span
+		ctx, span := trace.StartSpanWithRemoteParent(ctx, name, trace.SpanContext{}, startOptions(sopts)...)
+		span.AddLink(trace.Link{
+			TraceID: sctx.TraceID,
+			SpanID:  sctx.SpanID,
+			Type:    trace.LinkTypeParent,
+		})
+
+		return ctx, span
+	}
+
+	return trace.StartSpanWithRemoteParent(ctx, name, sctx, startOptions(sopts)...)
+}
+
+// startOptions converts the given trace.StartOptions to trace.StartOption
+// functions, if no span kind is set trace.SpanKindServer is used
+func startOptions(sopts trace.StartOptions) []trace.StartOption {
+	kind := sopts.SpanKind
+	if kind == trace.SpanKindUnspecified {
+		kind = trace.SpanKindServer
+	}
+
+	opts := []trace.StartOption{
+		trace.WithSpanKind(kind),
+	}
+
+	if sopts.Sampler != nil {
+		opts = append(opts, trace.WithSampler(sopts.Sampler))
+	}
+
+	return opts
 }
 
 // WithContext will create a new span context and place it on the given context from a message. This
@@ -60,9 +133,9 @@ func WithContext(ctx context.Context, msg *sqs.Message, opts ...Option) context.
 		opt(o)
 	}
 
-	attrs := GetMessageAttributes(msg)
+	attrs := messageAttributes(msg, o.EnvelopeMode)
 
-	sctx, ok := o.Propagator.SpanContextFromMessageAttributes(attrs)
+	sctx, ok := spanContextFromMessage(msg, attrs, o)
 	if !ok {
 		return ctx
 	}
@@ -71,10 +144,23 @@ func WithContext(ctx context.Context, msg *sqs.Message, opts ...Option) context.
 }
 
 // SendMessageInputWithSpan adds span data to message input to propagate spans being send through
-// SQS directly.
+// SQS directly. Span data is added to the message attributes, or the message
+// system attributes if configured with SystemAttributePropagation. The size of
+// the message is recorded on the span and the OversizePolicy applied, the
+// RejectOversize policy only annotates the span here, the SQS client returns
+// the error instead of sending the message. The same applies to errors
+// offloading the message body if an Offloader is configured.
 func SendMessageInputWithSpan(ctx context.Context, in *sqs.SendMessageInput, opts ...Option) *sqs.SendMessageInput {
+	in, _ = sendMessageInputWithSpan(ctx, in, opts...)
+	return in
+}
+
+// sendMessageInputWithSpan adds span data to message input returning a
+// *ocaws.MessageTooLargeError if the message exceeds the maximum message size
+// and the RejectOversize policy is configured
+func sendMessageInputWithSpan(ctx context.Context, in *sqs.SendMessageInput, opts ...Option) (*sqs.SendMessageInput, error) {
 	if ctx == nil {
-		return in
+		return in, nil
 	}
 
 	o := DefaultOptions()
@@ -82,51 +168,329 @@ func SendMessageInputWithSpan(ctx context.Context, in *sqs.SendMessageInput, opt
 		opt(o)
 	}
 
-	if span := trace.FromContext(ctx); span != nil {
-		if in.MessageAttributes == nil {
-			in.MessageAttributes = make(map[string]*sqs.MessageAttributeValue)
+	span := trace.FromContext(ctx)
+	if span != nil && o.PropagationMode == SystemAttributePropagation {
+		in.MessageSystemAttributes = systemAttributesWithSpan(span, in.MessageSystemAttributes, o)
+	}
+
+	var err error
+	in.MessageBody, in.MessageAttributes, err = messageWithSpan(ctx, span, in.QueueUrl, in.MessageBody, in.MessageAttributes, o)
+
+	return in, err
+}
+
+// SendMessageBatchRequestEntryWithSpan adds span data to a batch request entry
+// to propagate spans being sent through SQS in batches. Entries do not carry
+// their own queue url so this must be given from the SendMessageBatchInput.
+// The message size is handled the same as SendMessageInputWithSpan.
+func SendMessageBatchRequestEntryWithSpan(ctx context.Context, queueURL *string, entry *sqs.SendMessageBatchRequestEntry, opts ...Option) *sqs.SendMessageBatchRequestEntry {
+	entry, _ = sendMessageBatchRequestEntryWithSpan(ctx, queueURL, entry, opts...)
+	return entry
+}
+
+// sendMessageBatchRequestEntryWithSpan adds span data to a batch request
+// entry returning a *ocaws.MessageTooLargeError if the entry exceeds the
+// maximum message size and the RejectOversize policy is configured
+func sendMessageBatchRequestEntryWithSpan(ctx context.Context, queueURL *string, entry *sqs.SendMessageBatchRequestEntry, opts ...Option) (*sqs.SendMessageBatchRequestEntry, error) {
+	if ctx == nil {
+		return entry, nil
+	}
+
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	span := trace.FromContext(ctx)
+	if span != nil && o.PropagationMode == SystemAttributePropagation {
+		entry.MessageSystemAttributes = systemAttributesWithSpan(span, entry.MessageSystemAttributes, o)
+	}
+
+	var err error
+	entry.MessageBody, entry.MessageAttributes, err = messageWithSpan(ctx, span, queueURL, entry.MessageBody, entry.MessageAttributes, o)
+
+	return entry, err
+}
+
+// messageWithSpan adds the span context to a copy of the message attributes
+// and applies the oversize policy, the message body is offloaded first if an
+// Offloader is configured. The span may be nil in which case the body is only
+// offloaded. Offloading needs a message attribute for the size of the body so
+// the queue url is only added if there is still room once the body has been
+// offloaded.
+func messageWithSpan(ctx context.Context, span *trace.Span, queueURL *string, body *string, attrs map[string]*sqs.MessageAttributeValue, o *Options) (*string, map[string]*sqs.MessageAttributeValue, error) {
+	orig := toCarrier(attrs)
+	prev := orig
+
+	var p *ocaws.Propagation
+	if span != nil && o.PropagationMode != SystemAttributePropagation {
+		p = messagePropagation(queueURL, o)
+	}
+
+	if o.Offloader != nil {
+		size := ocaws.MessageSize(body, prev)
+		if p != nil {
+			withSpan, _ := p.Propagate(span.SpanContext(), prev)
+			size = ocaws.MessageSize(body, withSpan)
 		}
 
-		if ok := o.Propagator.SpanContextToMessageAttributes(span.SpanContext(), in.MessageAttributes); ok {
-			if in.QueueUrl != nil {
-				in.MessageAttributes[ocaws.TraceQueueURL] = &sqs.MessageAttributeValue{
-					StringValue: in.QueueUrl,
-					DataType:    aws.String("String"),
-				}
-			}
+		var err error
+		if body, prev, err = o.Offloader.Offload(ctx, body, prev, size); err != nil {
+			return body, attrs, err
 		}
 	}
 
+	if span == nil {
+		return body, fromCarrier(attrs, orig, prev), nil
+	}
+
+	next := prev
+	if p != nil {
+		next = p.Apply(span, prev)
+	}
+
+	next, err := o.OversizePolicy.Apply(span, MessageSizeAttribute, body, next, prev)
+
+	return body, fromCarrier(attrs, orig, next), err
+}
+
+// LoadMessageBody returns a copy of the message with its body downloaded from
+// S3 if the body is a pointer to an offloaded body and an Offloader is
+// configured, otherwise the message is returned as is. Messages published
+// through SNS without raw message delivery keep their SNS envelope, the
+// pointer in the envelope is replaced with the downloaded body. The envelope
+// is decoded according to the configured EnvelopeMode. Use the context
+// returned by StartSpan so the download is a child of the messages span.
+func LoadMessageBody(ctx context.Context, msg *sqs.Message, opts ...Option) (*sqs.Message, error) {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return loadMessageBody(ctx, msg, decodeEnvelope(msg, o.EnvelopeMode), o)
+}
+
+// loadMessageBody downloads the body of the message, n is the SNS envelope of
+// the message if it has one, see LoadMessageBody
+func loadMessageBody(ctx context.Context, msg *sqs.Message, n *ocsns.Notification, o *Options) (*sqs.Message, error) {
+	if o.Offloader == nil || msg.Body == nil {
+		return msg, nil
+	}
+
+	var (
+		body string
+		err  error
+	)
+
+	if n != nil {
+		body, err = loadEnvelopeMessage(ctx, *msg.Body, n, o.Offloader)
+	} else {
+		body, err = o.Offloader.Get(ctx, *msg.Body)
+	}
+
+	if err != nil {
+		return msg, err
+	}
+
+	m := *msg
+	m.Body = aws.String(body)
+
+	return &m, nil
+}
+
+// loadEnvelopeMessage returns the SNS envelope with its message downloaded
+// from S3 if the message is a pointer to an offloaded body, otherwise the
+// envelope is returned as is
+func loadEnvelopeMessage(ctx context.Context, envelope string, n *ocsns.Notification, off *offload.Offloader) (string, error) {
+	if _, ok := offload.ParsePointer(n.Message); !ok {
+		return envelope, nil
+	}
+
+	message, err := off.Get(ctx, n.Message)
+	if err != nil {
+		return envelope, err
+	}
+
+	// Only the message is replaced so the envelope keeps any fields not
+	// decoded into a Notification
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(envelope), &fields); err != nil {
+		return envelope, err
+	}
+
+	if fields["Message"], err = json.Marshal(message); err != nil {
+		return envelope, err
+	}
+
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return envelope, err
+	}
+
+	return string(b), nil
+}
+
+// systemAttributesWithSpan applies the span context to the given message
+// system attributes using the configured propagator, system attributes do not
+// count towards the message attribute limit
+func systemAttributesWithSpan(span *trace.Span, attrs map[string]*sqs.MessageSystemAttributeValue, o *Options) map[string]*sqs.MessageSystemAttributeValue {
+	if attrs == nil {
+		attrs = make(map[string]*sqs.MessageSystemAttributeValue)
+	}
+
+	if ok := o.Propagator.SpanContextToMessageAttributes(span.SpanContext(), attrs); !ok {
+		span.Annotate(nil, "Span context not propagated: propagator does not support message system attributes")
+	}
+
+	return attrs
+}
+
+// spanContextFromMessage returns the span context from the message according
+// to the configured propagation mode, the message attributes are given as they
+// may have been decoded from an SNS envelope
+func spanContextFromMessage(msg *sqs.Message, attrs map[string]*sqs.MessageAttributeValue, o *Options) (trace.SpanContext, bool) {
+	if o.PropagationMode == SystemAttributePropagation {
+		return o.Propagator.SpanContextFromMessageAttributes(msg.Attributes)
+	}
+
+	if sc, ok := o.Propagator.SpanContextFromMessageAttributes(attrs); ok {
+		return sc, ok
+	}
+
+	if o.FallbackPropagator != nil {
+		return o.FallbackPropagator.SpanContextFromMessageAttributes(attrs)
+	}
+
+	return trace.SpanContext{}, false
+}
+
+// ReceiveMessageInputWithAttributeNames ensures the receive message input
+// requests all message attributes so span context attributes are returned on
+// received messages, along with all system attributes such as the FIFO
+// message group id and sequence number.
+func ReceiveMessageInputWithAttributeNames(in *sqs.ReceiveMessageInput) *sqs.ReceiveMessageInput {
+	if !containsName(in.MessageAttributeNames, "All", ".*") {
+		in.MessageAttributeNames = append(in.MessageAttributeNames, aws.String("All"))
+	}
+
+	if !containsName(in.AttributeNames, sqs.QueueAttributeNameAll) {
+		in.AttributeNames = append(in.AttributeNames, aws.String(sqs.QueueAttributeNameAll))
+	}
+
 	return in
 }
 
-// GetMessageAttributes returns message attributes from an SQS message
-func GetMessageAttributes(msg *sqs.Message) map[string]*sqs.MessageAttributeValue {
-	if msg.MessageAttributes != nil {
-		return msg.MessageAttributes
+// containsName returns true if any of the names are in the given list
+func containsName(list []*string, names ...string) bool {
+	for _, v := range list {
+		for _, name := range names {
+			if v != nil && *v == name {
+				return true
+			}
+		}
 	}
 
-	attr := map[string]*sqs.MessageAttributeValue{}
-	if msg.Body == nil {
+	return false
+}
+
+// GetMessageAttributes returns message attributes from an SQS message decoded
+// according to the configured EnvelopeMode, by default AutoEnvelope.
+func GetMessageAttributes(msg *sqs.Message, opts ...Option) map[string]*sqs.MessageAttributeValue {
+	o := DefaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return messageAttributes(msg, o.EnvelopeMode)
+}
+
+// messageAttributes returns message attributes from an SQS message according
+// to the given envelope mode
+func messageAttributes(msg *sqs.Message, mode EnvelopeMode) map[string]*sqs.MessageAttributeValue {
+	return envelopedMessageAttributes(msg, decodeEnvelope(msg, mode), mode)
+}
+
+// decodeMessage returns a shallow copy of the message with its message
+// attributes decoded according to the given envelope mode along with the SNS
+// envelope of the message, nil if it has none. The envelope is decoded once so
+// it can be reused for the latency and body of the message.
+func decodeMessage(msg *sqs.Message, mode EnvelopeMode) (*sqs.Message, *ocsns.Notification) {
+	n := decodeEnvelope(msg, mode)
+
+	attr := envelopedMessageAttributes(msg, n, mode)
+	if attr == nil {
+		attr = make(map[string]*sqs.MessageAttributeValue)
+	}
+
+	m := *msg
+	m.MessageAttributes = attr
+
+	return &m, n
+}
+
+// decodeEnvelope decodes the SNS envelope in the message body, nil is
+// returned if the message has no envelope. The body is only decoded in
+// SNSEnvelope mode or in AutoEnvelope mode if the message has no message
+// attributes, so raw messages are not decoded as SNS envelopes.
+func decodeEnvelope(msg *sqs.Message, mode EnvelopeMode) *ocsns.Notification {
+	switch {
+	case mode == RawMessageDelivery:
+		return nil
+	case mode == AutoEnvelope && msg.MessageAttributes != nil:
+		return nil
+	case msg.Body == nil || !strings.HasPrefix(*msg.Body, "{"):
 		return nil
 	}
 
-	dst := map[string]json.RawMessage{}
-	if err := json.Unmarshal([]byte(*msg.Body), &dst); err != nil {
+	n, err := ocsns.DecodeNotification([]byte(*msg.Body))
+	if err != nil {
 		return nil
 	}
 
-	if v, ok := dst["MessageAttributes"]; ok {
-		dst := map[string]map[string]string{}
-		if err := json.Unmarshal(v, &dst); err != nil {
-			return nil
+	return n
+}
+
+// envelopedMessageAttributes returns the message attributes of a message with
+// the given SNS envelope according to the envelope mode
+func envelopedMessageAttributes(msg *sqs.Message, n *ocsns.Notification, mode EnvelopeMode) map[string]*sqs.MessageAttributeValue {
+	switch mode {
+	case RawMessageDelivery:
+		return msg.MessageAttributes
+	case SNSEnvelope:
+		attr := make(map[string]*sqs.MessageAttributeValue, len(msg.MessageAttributes))
+		for k, v := range msg.MessageAttributes {
+			attr[k] = v
 		}
 
-		for k, v := range dst {
-			attr[k] = &sqs.MessageAttributeValue{
-				DataType:    aws.String("String"),
-				StringValue: aws.String(v["Value"]),
-			}
+		// Envelope attributes carry the span context from the publisher so
+		// take precedence over the SQS message attributes
+		for k, v := range envelopeMessageAttributes(n) {
+			attr[k] = v
+		}
+
+		return attr
+	default:
+		if msg.MessageAttributes != nil {
+			return msg.MessageAttributes
+		}
+
+		return envelopeMessageAttributes(n)
+	}
+}
+
+// envelopeMessageAttributes returns the message attributes from an SNS
+// envelope, nil is returned if there is no envelope
+func envelopeMessageAttributes(n *ocsns.Notification) map[string]*sqs.MessageAttributeValue {
+	if n == nil {
+		return nil
+	}
+
+	attr := make(map[string]*sqs.MessageAttributeValue, len(n.MessageAttributes))
+	for k, v := range n.MessageAttributes {
+		attr[k] = &sqs.MessageAttributeValue{
+			DataType:    v.DataType,
+			StringValue: v.StringValue,
+			BinaryValue: v.BinaryValue,
 		}
 	}
 
@@ -134,7 +498,9 @@ func GetMessageAttributes(msg *sqs.Message) map[string]*sqs.MessageAttributeValu
 }
 
 // DefaultFormatSpanName formats a span name according to the given SQS
-// message.
+// message. When called by StartSpan the message attributes have already been
+// decoded according to the configured EnvelopeMode, otherwise AutoEnvelope is
+// used.
 func DefaultFormatSpanName(msg *sqs.Message) string {
 	format := []string{
 		"sqs.Message",
@@ -150,18 +516,13 @@ func DefaultFormatSpanName(msg *sqs.Message) string {
 		mid,
 	}
 
-	if msg.MessageAttributes != nil {
+	if attrs := GetMessageAttributes(msg); attrs != nil {
 		var topic string
-		if v, ok := msg.MessageAttributes[ocaws.TraceTopicName]; ok && v.StringValue != nil {
+		if v, ok := attrs[ocaws.TraceTopicName]; ok && v.StringValue != nil {
 			topic = *v.StringValue
 		}
 
-		var queue string
-		if v, ok := msg.MessageAttributes[ocaws.TraceQueueURL]; ok && v.StringValue != nil {
-			if u, err := url.Parse(*v.StringValue); err == nil {
-				queue = strings.TrimLeft(u.Path, "/")
-			}
-		}
+		queue := queuePath(attrs)
 
 		switch {
 		case (topic != "" && queue != ""):
@@ -179,6 +540,35 @@ func DefaultFormatSpanName(msg *sqs.Message) string {
 	return fmt.Sprintf(strings.Join(format, "/"), values...)
 }
 
+// MessageGroupFormatSpanName formats a span name from the queue and message
+// group of messages received from FIFO queues, grouping spans by message group
+// which is useful for debugging ordering within groups. Messages without a
+// message group are formatted by DefaultFormatSpanName. Remember to request
+// the MessageGroupId attribute when receiving messages.
+func MessageGroupFormatSpanName(msg *sqs.Message) string {
+	group, ok := msg.Attributes[sqs.MessageSystemAttributeNameMessageGroupId]
+	if !ok || group == nil {
+		return DefaultFormatSpanName(msg)
+	}
+
+	if queue := queuePath(GetMessageAttributes(msg)); queue != "" {
+		return fmt.Sprintf("sqs.MessageGroup/%s/%s", queue, *group)
+	}
+
+	return fmt.Sprintf("sqs.MessageGroup/%s", *group)
+}
+
+// queuePath returns the queue path from the trace queue url message attribute
+func queuePath(attrs map[string]*sqs.MessageAttributeValue) string {
+	if v, ok := attrs[ocaws.TraceQueueURL]; ok && v.StringValue != nil {
+		if u, err := url.Parse(*v.StringValue); err == nil {
+			return strings.TrimLeft(u.Path, "/")
+		}
+	}
+
+	return ""
+}
+
 // SpanFromContext will return a span context from context
 func SpanFromContext(ctx context.Context) (trace.SpanContext, bool) {
 	v, ok := ctx.Value(spanContextKey{}).(trace.SpanContext)
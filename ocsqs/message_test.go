@@ -0,0 +1,963 @@
+package ocsqs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.krak3n.codes/ocaws"
+	"go.krak3n.codes/ocaws/ocawstest"
+	"go.krak3n.codes/ocaws/offload"
+	"go.krak3n.codes/ocaws/propagation/b3"
+	"go.krak3n.codes/ocaws/propagation/xray"
+	"go.opencensus.io/trace"
+)
+
+func TestSendMessageBatchRequestEntryWithSpan(t *testing.T) {
+	type TestCase struct {
+		tName      string
+		ctx        context.Context
+		queueURL   *string
+		entry      *sqs.SendMessageBatchRequestEntry
+		attributes map[string]*sqs.MessageAttributeValue
+	}
+	tt := []TestCase{
+		{
+			tName: "no span",
+			ctx:   context.Background(),
+			entry: &sqs.SendMessageBatchRequestEntry{
+				Id: aws.String("1"),
+			},
+		},
+		{
+			tName: "no queue url",
+			ctx: func() context.Context {
+				ctx, span := trace.StartSpan(context.Background(), t.Name())
+				defer span.End()
+
+				return ctx
+			}(),
+			entry: &sqs.SendMessageBatchRequestEntry{
+				Id: aws.String("1"),
+			},
+			attributes: map[string]*sqs.MessageAttributeValue{
+				b3.TraceIDKey: &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String(ocawstest.DefaultTraceID.String()),
+				},
+				b3.SpanIDKey: &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String(ocawstest.DefaultSpanID.String()),
+				},
+				b3.SpanSampledKey: &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String("0"),
+				},
+			},
+		},
+		{
+			tName: "ok",
+			ctx: func() context.Context {
+				ctx, span := trace.StartSpan(context.Background(), t.Name())
+				defer span.End()
+
+				return ctx
+			}(),
+			queueURL: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo"),
+			entry: &sqs.SendMessageBatchRequestEntry{
+				Id: aws.String("1"),
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					"Foo": &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String("Bar"),
+					},
+				},
+			},
+			attributes: map[string]*sqs.MessageAttributeValue{
+				"Foo": &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String("Bar"),
+				},
+				b3.TraceIDKey: &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String(ocawstest.DefaultTraceID.String()),
+				},
+				b3.SpanIDKey: &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String(ocawstest.DefaultSpanID.String()),
+				},
+				b3.SpanSampledKey: &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String("0"),
+				},
+				ocaws.TraceQueueURL: &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo"),
+				},
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			entry := SendMessageBatchRequestEntryWithSpan(tc.ctx, tc.queueURL, tc.entry)
+
+			assert.Equal(t, tc.attributes, entry.MessageAttributes)
+		})
+	}
+}
+
+func TestReceiveMessageInputWithAttributeNames(t *testing.T) {
+	type TestCase struct {
+		tName  string
+		in     *sqs.ReceiveMessageInput
+		names  []*string
+		system []*string
+	}
+	tt := []TestCase{
+		{
+			tName:  "no names",
+			in:     &sqs.ReceiveMessageInput{},
+			names:  []*string{aws.String("All")},
+			system: []*string{aws.String("All")},
+		},
+		{
+			tName: "with names",
+			in: &sqs.ReceiveMessageInput{
+				MessageAttributeNames: []*string{aws.String("Foo")},
+				AttributeNames:        []*string{aws.String("SentTimestamp")},
+			},
+			names:  []*string{aws.String("Foo"), aws.String("All")},
+			system: []*string{aws.String("SentTimestamp"), aws.String("All")},
+		},
+		{
+			tName: "with all",
+			in: &sqs.ReceiveMessageInput{
+				MessageAttributeNames: []*string{aws.String("All")},
+				AttributeNames:        []*string{aws.String("All")},
+			},
+			names:  []*string{aws.String("All")},
+			system: []*string{aws.String("All")},
+		},
+		{
+			tName: "with wildcard",
+			in: &sqs.ReceiveMessageInput{
+				MessageAttributeNames: []*string{aws.String(".*")},
+			},
+			names:  []*string{aws.String(".*")},
+			system: []*string{aws.String("All")},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			in := ReceiveMessageInputWithAttributeNames(tc.in)
+
+			assert.Equal(t, tc.names, in.MessageAttributeNames)
+			assert.Equal(t, tc.system, in.AttributeNames)
+		})
+	}
+}
+
+func TestMessageGroupFormatSpanName(t *testing.T) {
+	type TestCase struct {
+		tName string
+		msg   *sqs.Message
+		name  string
+	}
+	tt := []TestCase{
+		{
+			tName: "no message group",
+			msg: &sqs.Message{
+				MessageId: aws.String("some-message-id"),
+			},
+			name: "sqs.Message/some-message-id",
+		},
+		{
+			tName: "message group",
+			msg: &sqs.Message{
+				MessageId: aws.String("some-message-id"),
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameMessageGroupId: aws.String("some-group"),
+				},
+			},
+			name: "sqs.MessageGroup/some-group",
+		},
+		{
+			tName: "message group with queue url",
+			msg: &sqs.Message{
+				MessageId: aws.String("some-message-id"),
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameMessageGroupId: aws.String("some-group"),
+				},
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					ocaws.TraceQueueURL: &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Bar.fifo"),
+					},
+				},
+			},
+			name: "sqs.MessageGroup/123456789101112/Bar.fifo/some-group",
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.name, MessageGroupFormatSpanName(tc.msg))
+		})
+	}
+}
+
+func TestStartSpan(t *testing.T) {
+	type TestCase struct {
+		tName  string
+		msg    *sqs.Message
+		opts   []Option
+		kind   int
+		parent trace.SpanID
+		links  []trace.Link
+	}
+	tt := []TestCase{
+		{
+			tName: "no parent with start options",
+			msg:   &sqs.Message{},
+			opts: []Option{
+				WithStartOptions(trace.StartOptions{
+					Sampler:  trace.AlwaysSample(),
+					SpanKind: trace.SpanKindClient,
+				}),
+			},
+			kind: trace.SpanKindClient,
+		},
+		{
+			tName: "no parent with get start options",
+			msg:   &sqs.Message{},
+			opts: []Option{
+				WithGetStartOptions(func(*sqs.Message) trace.StartOptions {
+					return trace.StartOptions{
+						Sampler: trace.AlwaysSample(),
+					}
+				}),
+			},
+			kind: trace.SpanKindServer,
+		},
+		{
+			tName: "with parent",
+			msg: &sqs.Message{
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					b3.TraceIDKey: &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String(ocawstest.DefaultTraceID.String()),
+					},
+					b3.SpanIDKey: &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String(ocawstest.DefaultSpanID.String()),
+					},
+					b3.SpanSampledKey: &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String("0"),
+					},
+				},
+			},
+			opts: []Option{
+				WithStartOptions(trace.StartOptions{
+					Sampler: trace.AlwaysSample(),
+				}),
+			},
+			kind:   trace.SpanKindServer,
+			parent: ocawstest.DefaultSpanID,
+		},
+		{
+			tName: "with linked spans",
+			msg: &sqs.Message{
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					b3.TraceIDKey: &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String(ocawstest.DefaultTraceID.String()),
+					},
+					b3.SpanIDKey: &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String(ocawstest.DefaultSpanID.String()),
+					},
+				},
+			},
+			opts: []Option{
+				WithLinkedSpans(),
+				WithStartOptions(trace.StartOptions{
+					Sampler: trace.AlwaysSample(),
+				}),
+			},
+			kind: trace.SpanKindServer,
+			links: []trace.Link{
+				{
+					TraceID: ocawstest.DefaultTraceID,
+					SpanID:  ocawstest.DefaultSpanID,
+					Type:    trace.LinkTypeParent,
+				},
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			name := t.Name()
+			opts := append(tc.opts, WithFormatSpanName(func(*sqs.Message) string {
+				return name
+			}))
+
+			_, span := StartSpan(context.Background(), tc.msg, opts...)
+			span.End()
+
+			sd, ok := exporter.Span(name)
+			if assert.True(t, ok) {
+				assert.Equal(t, tc.kind, sd.SpanKind)
+				assert.Equal(t, tc.parent, sd.ParentSpanID)
+				assert.Equal(t, tc.links, sd.Links)
+				assert.True(t, sd.IsSampled())
+			}
+		})
+	}
+}
+
+func TestStartSpanFromContext(t *testing.T) {
+	type TestCase struct {
+		tName  string
+		ctx    context.Context
+		parent trace.SpanID
+	}
+	tt := []TestCase{
+		{
+			tName: "no span context",
+			ctx:   context.Background(),
+		},
+		{
+			tName: "with span context",
+			ctx: context.WithValue(context.Background(), spanContextKey{}, trace.SpanContext{
+				TraceID: ocawstest.DefaultTraceID,
+				SpanID:  ocawstest.DefaultSpanID,
+			}),
+			parent: ocawstest.DefaultSpanID,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, span := StartSpanFromContext(tc.ctx, t.Name(), WithStartOptions(trace.StartOptions{
+				Sampler: trace.AlwaysSample(),
+			}))
+			span.End()
+
+			_, ok := SpanFromContext(ctx)
+			assert.False(t, ok)
+
+			sd, ok := exporter.Span(t.Name())
+			if assert.True(t, ok) {
+				assert.Equal(t, trace.SpanKindServer, sd.SpanKind)
+				assert.Equal(t, tc.parent, sd.ParentSpanID)
+			}
+		})
+	}
+}
+
+func TestGetMessageAttributes(t *testing.T) {
+	msg := &sqs.Message{
+		Body: aws.String(`{"Type":"Notification","MessageAttributes":{"Foo":{"Type":"String","Value":"Bar"}}}`),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"Baz": &sqs.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String("Qux"),
+			},
+		},
+	}
+
+	type TestCase struct {
+		tName string
+		msg   *sqs.Message
+		opts  []Option
+		attrs map[string]*sqs.MessageAttributeValue
+	}
+	tt := []TestCase{
+		{
+			tName: "auto",
+			msg:   msg,
+			attrs: msg.MessageAttributes,
+		},
+		{
+			tName: "auto no message attributes",
+			msg: &sqs.Message{
+				Body: msg.Body,
+			},
+			attrs: map[string]*sqs.MessageAttributeValue{
+				"Foo": &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String("Bar"),
+				},
+			},
+		},
+		{
+			tName: "raw message delivery",
+			msg: &sqs.Message{
+				Body: msg.Body,
+			},
+			opts: []Option{
+				WithRawMessageDelivery(),
+			},
+		},
+		{
+			tName: "sns envelope",
+			msg:   msg,
+			opts: []Option{
+				WithSNSEnvelope(),
+			},
+			attrs: map[string]*sqs.MessageAttributeValue{
+				"Foo": &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String("Bar"),
+				},
+				"Baz": &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String("Qux"),
+				},
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.attrs, GetMessageAttributes(tc.msg, tc.opts...))
+		})
+	}
+}
+
+func Test_decodeMessage(t *testing.T) {
+	body := aws.String(`{"Type":"Notification","Message":"Bar","MessageAttributes":{"Foo":{"Type":"String","Value":"Bar"}}}`)
+
+	type TestCase struct {
+		tName    string
+		msg      *sqs.Message
+		mode     EnvelopeMode
+		message  string
+		envelope bool
+	}
+	tt := []TestCase{
+		{
+			tName:    "auto",
+			msg:      &sqs.Message{Body: body},
+			message:  "Bar",
+			envelope: true,
+		},
+		{
+			tName:    "sns envelope",
+			msg:      &sqs.Message{Body: body},
+			mode:     SNSEnvelope,
+			message:  "Bar",
+			envelope: true,
+		},
+		{
+			tName: "auto with message attributes",
+			msg: &sqs.Message{
+				Body:              body,
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{},
+			},
+		},
+		{
+			tName: "raw message delivery",
+			msg:   &sqs.Message{Body: body},
+			mode:  RawMessageDelivery,
+		},
+		{
+			tName: "not an envelope",
+			msg:   &sqs.Message{Body: aws.String("foo")},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			msg, n := decodeMessage(tc.msg, tc.mode)
+			assert.Equal(t, tc.envelope, msg.MessageAttributes["Foo"] != nil)
+
+			if !tc.envelope {
+				assert.Nil(t, n)
+				return
+			}
+
+			require.NotNil(t, n)
+			assert.Equal(t, tc.message, n.Message)
+		})
+	}
+}
+
+func TestDefaultFormatSpanName(t *testing.T) {
+	type TestCase struct {
+		tName string
+		msg   *sqs.Message
+		name  string
+	}
+	tt := []TestCase{
+		{
+			tName: "empty message",
+			msg:   &sqs.Message{},
+			name:  "sqs.Message/unknwonMessageId",
+		},
+		{
+			tName: "with queue url and topic",
+			msg: &sqs.Message{
+				MessageId: aws.String("some-message-id"),
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					ocaws.TraceQueueURL: &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Bar"),
+					},
+					ocaws.TraceTopicName: &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String("Foo"),
+					},
+				},
+			},
+			name: "sqs.Message/Foo/123456789101112/Bar/some-message-id",
+		},
+		{
+			tName: "with sns envelope topic",
+			msg: &sqs.Message{
+				MessageId: aws.String("some-message-id"),
+				Body:      aws.String(`{"MessageAttributes":{"Trace-Topic-Name":{"Type":"String","Value":"Foo"}}}`),
+			},
+			name: "sqs.Message/Foo/some-message-id",
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.name, DefaultFormatSpanName(tc.msg))
+		})
+	}
+}
+
+func TestSendMessageInputWithSpan_messageAttributeLimit(t *testing.T) {
+	attrs := func(n int) map[string]*sqs.MessageAttributeValue {
+		attrs := make(map[string]*sqs.MessageAttributeValue, n)
+		for i := 0; i < n; i++ {
+			attrs[fmt.Sprintf("Attr%d", i)] = &sqs.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String("foo"),
+			}
+		}
+
+		return attrs
+	}
+
+	type TestCase struct {
+		tName string
+		attrs map[string]*sqs.MessageAttributeValue
+		keys  []string
+	}
+	tt := []TestCase{
+		{
+			tName: "fits",
+			attrs: attrs(6),
+			keys:  []string{b3.TraceIDKey, b3.SpanIDKey, b3.SpanSampledKey, ocaws.TraceQueueURL},
+		},
+		{
+			tName: "fits without queue url",
+			attrs: attrs(7),
+			keys:  []string{b3.TraceIDKey, b3.SpanIDKey, b3.SpanSampledKey},
+		},
+		{
+			tName: "fallback",
+			attrs: attrs(8),
+			keys:  []string{b3.SingleKey, ocaws.TraceQueueURL},
+		},
+		{
+			tName: "fallback without queue url",
+			attrs: attrs(9),
+			keys:  []string{b3.SingleKey},
+		},
+		{
+			tName: "skipped",
+			attrs: attrs(10),
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, span := trace.StartSpan(context.Background(), t.Name())
+			defer span.End()
+
+			n := len(tc.attrs)
+			in := SendMessageInputWithSpan(ctx, &sqs.SendMessageInput{
+				QueueUrl:          aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo"),
+				MessageAttributes: tc.attrs,
+			})
+
+			assert.Len(t, in.MessageAttributes, n+len(tc.keys))
+			for _, k := range tc.keys {
+				assert.Contains(t, in.MessageAttributes, k)
+			}
+		})
+	}
+}
+
+func TestSendMessageInputWithSpan_awsTraceHeader(t *testing.T) {
+	ctx, span := trace.StartSpan(context.Background(), t.Name())
+	defer span.End()
+
+	in := SendMessageInputWithSpan(ctx, &sqs.SendMessageInput{
+		QueueUrl: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo"),
+	}, WithAWSTraceHeader())
+
+	assert.Nil(t, in.MessageAttributes)
+	if assert.Contains(t, in.MessageSystemAttributes, xray.TraceHeaderKey) {
+		assert.Equal(t, xray.TraceHeader(span.SpanContext()), aws.StringValue(in.MessageSystemAttributes[xray.TraceHeaderKey].StringValue))
+	}
+}
+
+func TestSendMessageInputWithSpan_attributeValues(t *testing.T) {
+	ctx, span := trace.StartSpan(context.Background(), t.Name())
+	defer span.End()
+
+	list := &sqs.MessageAttributeValue{
+		DataType:         aws.String("String.List"),
+		StringListValues: aws.StringSlice([]string{"foo", "bar"}),
+	}
+
+	attrs := map[string]*sqs.MessageAttributeValue{
+		"List":        list,
+		"Nil":         nil,
+		b3.TraceIDKey: &sqs.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String("stale")},
+	}
+
+	in := SendMessageInputWithSpan(ctx, &sqs.SendMessageInput{
+		QueueUrl:          aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo"),
+		MessageAttributes: attrs,
+	})
+
+	assert.Equal(t, list, in.MessageAttributes["List"])
+	if assert.Contains(t, in.MessageAttributes, "Nil") {
+		assert.Nil(t, in.MessageAttributes["Nil"])
+	}
+
+	assert.Equal(t, span.SpanContext().TraceID.String(), aws.StringValue(in.MessageAttributes[b3.TraceIDKey].StringValue))
+	assert.Equal(t, "stale", aws.StringValue(attrs[b3.TraceIDKey].StringValue))
+	assert.Len(t, attrs, 3)
+}
+
+func TestWithContext_awsTraceHeader(t *testing.T) {
+	sc := trace.SpanContext{
+		TraceID: ocawstest.DefaultTraceID,
+		SpanID:  ocawstest.DefaultSpanID,
+	}
+
+	msg := &sqs.Message{
+		Attributes: map[string]*string{
+			xray.TraceHeaderKey: aws.String(xray.TraceHeader(sc)),
+		},
+	}
+
+	v, ok := SpanFromContext(WithContext(context.Background(), msg, WithAWSTraceHeader()))
+	assert.True(t, ok)
+	assert.Equal(t, sc, v)
+}
+
+func TestSendMessageInputWithSpan_oversizePolicy(t *testing.T) {
+	// A body which only exceeds the maximum message size once span context
+	// attributes have been added
+	body := strings.Repeat("a", ocaws.MaxMessageSize-ocaws.MessageSize(nil, map[string]*sqs.MessageAttributeValue{
+		"Foo": &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String("bar"),
+		},
+	}))
+
+	type TestCase struct {
+		tName  string
+		policy ocaws.OversizePolicy
+		keys   []string
+		err    error
+	}
+	tt := []TestCase{
+		{
+			tName:  "send",
+			policy: ocaws.SendOversize,
+			keys:   []string{"Foo", b3.TraceIDKey, b3.SpanIDKey, b3.SpanSampledKey, ocaws.TraceQueueURL},
+		},
+		{
+			tName:  "drop trace attributes",
+			policy: ocaws.DropTraceAttributes,
+			keys:   []string{"Foo"},
+		},
+		{
+			tName:  "reject",
+			policy: ocaws.RejectOversize,
+			keys:   []string{"Foo", b3.TraceIDKey, b3.SpanIDKey, b3.SpanSampledKey, ocaws.TraceQueueURL},
+			err:    &ocaws.MessageTooLargeError{Size: ocaws.MaxMessageSize + 179},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, span := trace.StartSpan(context.Background(), t.Name())
+			defer span.End()
+
+			in, err := sendMessageInputWithSpan(ctx, &sqs.SendMessageInput{
+				QueueUrl:    aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo"),
+				MessageBody: aws.String(body),
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					"Foo": &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String("bar"),
+					},
+				},
+			}, WithOversizePolicy(tc.policy))
+
+			assert.Equal(t, tc.err, err)
+			assert.Len(t, in.MessageAttributes, len(tc.keys))
+			for _, k := range tc.keys {
+				assert.Contains(t, in.MessageAttributes, k)
+			}
+		})
+	}
+}
+
+type TestS3 struct {
+	s3iface.S3API
+
+	PutObjectWithContextFunc func(aws.Context, *s3.PutObjectInput, ...request.Option) (*s3.PutObjectOutput, error)
+	GetObjectWithContextFunc func(aws.Context, *s3.GetObjectInput, ...request.Option) (*s3.GetObjectOutput, error)
+}
+
+func (s *TestS3) PutObjectWithContext(ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	return s.PutObjectWithContextFunc(ctx, in, opts...)
+}
+
+func (s *TestS3) GetObjectWithContext(ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	return s.GetObjectWithContextFunc(ctx, in, opts...)
+}
+
+func TestSendMessageInputWithSpan_offload(t *testing.T) {
+	type TestCase struct {
+		tName  string
+		body   string
+		attrs  int
+		noSpan bool
+		err    error
+		put    bool
+		keys   []string
+	}
+	tt := []TestCase{
+		{
+			tName: "small message",
+			body:  "foo",
+		},
+		{
+			tName: "large message",
+			body:  strings.Repeat("a", ocaws.MaxMessageSize),
+			put:   true,
+		},
+		{
+			tName:  "large message without span",
+			body:   strings.Repeat("a", ocaws.MaxMessageSize+1),
+			noSpan: true,
+			put:    true,
+		},
+		{
+			tName: "put error",
+			body:  strings.Repeat("a", ocaws.MaxMessageSize),
+			err:   errors.New("boom"),
+			put:   true,
+		},
+		{
+			tName: "queue url dropped for the payload size",
+			body:  strings.Repeat("a", ocaws.MaxMessageSize),
+			attrs: 6,
+			put:   true,
+			keys:  []string{b3.TraceIDKey, b3.SpanIDKey, b3.SpanSampledKey},
+		},
+		{
+			tName: "fallback propagator for the payload size",
+			body:  strings.Repeat("a", ocaws.MaxMessageSize),
+			attrs: 7,
+			put:   true,
+			keys:  []string{b3.SingleKey, ocaws.TraceQueueURL},
+		},
+		{
+			tName: "span context dropped for the payload size",
+			body:  strings.Repeat("a", ocaws.MaxMessageSize),
+			attrs: 9,
+			put:   true,
+		},
+		{
+			tName: "message attribute limit",
+			body:  strings.Repeat("a", ocaws.MaxMessageSize),
+			attrs: ocaws.MaxMessageAttributes,
+			err:   offload.ErrTooManyAttributes,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			var put bool
+
+			off := offload.New(&TestS3{
+				PutObjectWithContextFunc: func(ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+					put = true
+					return &s3.PutObjectOutput{}, tc.err
+				},
+			}, "foo", offload.WithKeyFunc(func() string { return "bar" }))
+
+			attrs := make(map[string]*sqs.MessageAttributeValue)
+			for i := 0; i < tc.attrs; i++ {
+				attrs[fmt.Sprintf("Foo%d", i)] = &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String("bar"),
+				}
+			}
+
+			ctx := context.Background()
+			if !tc.noSpan {
+				var span *trace.Span
+				ctx, span = trace.StartSpan(ctx, t.Name())
+				defer span.End()
+			}
+
+			in, err := sendMessageInputWithSpan(ctx, &sqs.SendMessageInput{
+				QueueUrl:          aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo"),
+				MessageBody:       aws.String(tc.body),
+				MessageAttributes: attrs,
+			}, WithOffloader(off))
+
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.put, put)
+			assert.Len(t, attrs, tc.attrs, "caller attributes changed")
+
+			if tc.put && tc.err == nil {
+				assert.Equal(t, offload.Pointer{Bucket: "foo", Key: "bar"}.String(), aws.StringValue(in.MessageBody))
+				require.Contains(t, in.MessageAttributes, offload.SizeAttribute)
+				assert.Equal(t, fmt.Sprint(len(tc.body)), aws.StringValue(in.MessageAttributes[offload.SizeAttribute].StringValue))
+
+				if tc.keys != nil || tc.attrs > 0 {
+					assert.Len(t, in.MessageAttributes, tc.attrs+len(tc.keys)+1)
+					for _, k := range tc.keys {
+						assert.Contains(t, in.MessageAttributes, k)
+					}
+				}
+			} else {
+				assert.Equal(t, tc.body, aws.StringValue(in.MessageBody))
+				assert.NotContains(t, in.MessageAttributes, offload.SizeAttribute)
+			}
+		})
+	}
+}
+
+func TestLoadMessageBody(t *testing.T) {
+	type TestCase struct {
+		tName string
+		body  string
+		opts  []Option
+		want  string
+	}
+
+	off := offload.New(&TestS3{
+		GetObjectWithContextFunc: func(ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body: ioutil.NopCloser(strings.NewReader("baz")),
+			}, nil
+		},
+	}, "foo")
+
+	ptr := offload.Pointer{Bucket: "foo", Key: "bar"}.String()
+
+	envelope := func(message string) string {
+		b, err := json.Marshal(message)
+		require.NoError(t, err)
+
+		return `{"Message":` + string(b) + `,"Type":"Notification"}`
+	}
+
+	tt := []TestCase{
+		{
+			tName: "no offloader",
+			body:  ptr,
+			want:  ptr,
+		},
+		{
+			tName: "not a pointer",
+			body:  "foo",
+			opts:  []Option{WithOffloader(off)},
+			want:  "foo",
+		},
+		{
+			tName: "pointer",
+			body:  ptr,
+			opts:  []Option{WithOffloader(off)},
+			want:  "baz",
+		},
+		{
+			tName: "sns envelope",
+			body:  envelope(ptr),
+			opts:  []Option{WithOffloader(off)},
+			want:  envelope("baz"),
+		},
+		{
+			tName: "sns envelope not a pointer",
+			body:  envelope("foo"),
+			opts:  []Option{WithOffloader(off)},
+			want:  envelope("foo"),
+		},
+		{
+			tName: "raw message delivery ignores envelope",
+			body:  envelope(ptr),
+			opts:  []Option{WithOffloader(off), WithRawMessageDelivery()},
+			want:  envelope(ptr),
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			msg := &sqs.Message{
+				Body:          aws.String(tc.body),
+				ReceiptHandle: aws.String("foo"),
+			}
+
+			m, err := LoadMessageBody(context.Background(), msg, tc.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, aws.StringValue(m.Body))
+			assert.Equal(t, "foo", aws.StringValue(m.ReceiptHandle))
+			assert.Equal(t, tc.body, aws.StringValue(msg.Body))
+		})
+	}
+}
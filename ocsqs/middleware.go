@@ -0,0 +1,49 @@
+package ocsqs
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+)
+
+// A Middleware wraps a Handler adding behaviour around handling messages
+type Middleware func(Handler) Handler
+
+// Chain wraps the handler in the middleware, the first middleware is the
+// outermost and so is called first
+func Chain(handler Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		handler = mws[i](handler)
+	}
+
+	return handler
+}
+
+// TracingMiddleware starts a span for each message using StartSpan, the span
+// status is set from the error returned by the handler. If the handler panics
+// the span is marked as an internal error before re-panicking. Offloaded
+// message bodies are downloaded before calling the handler. The Consumer already
+// starts a span for each message, use this when handling messages received
+// by your own receive loop.
+func TracingMiddleware(opts ...Option) Middleware {
+	return Middleware(func(next Handler) Handler {
+		return Handler(func(ctx context.Context, msg *sqs.Message) error {
+			ctx, span := StartSpan(ctx, msg, opts...)
+			defer func() {
+				if v := recover(); v != nil {
+					endSpanWithPanic(span, v)
+					panic(v)
+				}
+			}()
+
+			msg, err := LoadMessageBody(ctx, msg, opts...)
+			if err == nil {
+				err = next(ctx, msg)
+			}
+
+			EndSpan(span, err)
+
+			return err
+		})
+	})
+}
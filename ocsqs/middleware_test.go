@@ -0,0 +1,74 @@
+package ocsqs
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/trace"
+)
+
+func TestChain(t *testing.T) {
+	var calls []string
+
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, msg *sqs.Message) error {
+				calls = append(calls, name)
+				return next(ctx, msg)
+			}
+		}
+	}
+
+	handler := Chain(func(context.Context, *sqs.Message) error {
+		calls = append(calls, "handler")
+		return nil
+	}, mw("first"), mw("second"))
+
+	require.NoError(t, handler(context.Background(), &sqs.Message{}))
+	assert.Equal(t, []string{"first", "second", "handler"}, calls)
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	type TestCase struct {
+		tName string
+		err   error
+		code  int32
+	}
+	tt := []TestCase{
+		{
+			tName: "ok",
+		},
+		{
+			tName: "error",
+			err:   errors.New("boom"),
+			code:  trace.StatusCodeUnknown,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			name := "sqs.Message/" + t.Name()
+
+			handler := Chain(func(ctx context.Context, msg *sqs.Message) error {
+				assert.NotNil(t, trace.FromContext(ctx))
+				return tc.err
+			}, TracingMiddleware(WithStartOptions(trace.StartOptions{
+				Sampler: trace.AlwaysSample(),
+			})))
+
+			err := handler(context.Background(), &sqs.Message{MessageId: aws.String(t.Name())})
+			assert.Equal(t, tc.err, err)
+
+			sd, ok := exporter.Span(name)
+			require.True(t, ok)
+			assert.Equal(t, tc.code, sd.Status.Code)
+		})
+	}
+}
@@ -2,8 +2,11 @@ package ocsqs
 
 import (
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.krak3n.codes/ocaws"
+	"go.krak3n.codes/ocaws/offload"
 	"go.krak3n.codes/ocaws/propagation"
 	"go.krak3n.codes/ocaws/propagation/b3"
+	"go.krak3n.codes/ocaws/propagation/xray"
 	"go.opencensus.io/trace"
 )
 
@@ -13,15 +16,58 @@ type GetStartOptionsFunc func(*sqs.Message) trace.StartOptions
 // A FormatSpanNameFunc formats a span name from the sqs message
 type FormatSpanNameFunc func(*sqs.Message) string
 
+// An EnvelopeMode defines how message attributes are decoded from SQS messages
+// which may have been delivered from an SNS topic
+type EnvelopeMode int
+
+// Envelope modes
+const (
+	// AutoEnvelope uses the SQS message attributes if the message has any,
+	// otherwise the message body is decoded as an SNS envelope
+	AutoEnvelope EnvelopeMode = iota
+
+	// RawMessageDelivery only uses the SQS message attributes, use this for
+	// messages sent directly to SQS or SNS subscriptions with
+	// RawMessageDelivery enabled
+	RawMessageDelivery
+
+	// SNSEnvelope decodes the message body as an SNS envelope merging the
+	// envelope message attributes with the SQS message attributes, envelope
+	// attributes take precedence
+	SNSEnvelope
+)
+
+// A PropagationMode defines where span contexts are propagated on SQS messages
+type PropagationMode int
+
+// Propagation modes
+const (
+	// MessageAttributePropagation propagates span contexts in message
+	// attributes which count towards the message attribute limit
+	MessageAttributePropagation PropagationMode = iota
+
+	// SystemAttributePropagation propagates span contexts in message system
+	// attributes, the Propagator must support message system attributes, see
+	// the xray propagator. The queue url is not added in this mode.
+	SystemAttributePropagation
+)
+
+// Options configure how spans are propagated and started from messages
 type Options struct {
 	// Propagator defines how traces will be propagated, if not specified this
 	// will be B3
 	Propagator propagation.Propagator
 
-	// StartOptions are applied to the span started by this Handler around each
-	// message.
-	// StartOptions.SpanKind will always be set to trace.SpanKindServer
-	// for spans started by this transport.
+	// FallbackPropagator is used when the span context attributes added by
+	// the Propagator would exceed the message attribute limit, it should use
+	// fewer attributes than the Propagator. It is also used to extract span
+	// contexts the Propagator could not find. By default this is the single
+	// attribute B3 propagator, set to nil to disable.
+	FallbackPropagator propagation.Propagator
+
+	// StartOptions are applied to the span started around each message
+	// whether or not a span context was propagated on the message.
+	// If StartOptions.SpanKind is not set trace.SpanKindServer will be used.
 	StartOptions trace.StartOptions
 
 	// GetStartOptions allows to set start options per message. If set,
@@ -31,13 +77,39 @@ type Options struct {
 	// FormatSpanName formats the span name based on the given sqs.Message. See
 	// DefaultFormatSpanName for the default format
 	FormatSpanName FormatSpanNameFunc
+
+	// LinkedSpans, if true, starts a new root span for each message with a
+	// link to the span context propagated on the message rather than
+	// starting a child span of it. This is useful for queues where messages
+	// can wait a long time before being processed, similar to ochttp's
+	// IsPublicEndpoint.
+	LinkedSpans bool
+
+	// EnvelopeMode defines how message attributes are decoded from messages,
+	// by default AutoEnvelope
+	EnvelopeMode EnvelopeMode
+
+	// PropagationMode defines where span contexts are propagated on messages,
+	// by default MessageAttributePropagation
+	PropagationMode PropagationMode
+
+	// OversizePolicy defines what happens when adding span context message
+	// attributes would exceed the maximum message size, by default the
+	// message is sent as is
+	OversizePolicy ocaws.OversizePolicy
+
+	// Offloader, if set, stores message bodies of messages which are too
+	// large in S3 sending a pointer to the body instead. Bodies are
+	// downloaded by LoadMessageBody.
+	Offloader *offload.Offloader
 }
 
 // DefaultOptions returns sane default options
 func DefaultOptions() *Options {
 	return &Options{
-		Propagator:     b3.New(),
-		FormatSpanName: DefaultFormatSpanName,
+		Propagator:         b3.New(),
+		FallbackPropagator: b3.NewSingle(),
+		FormatSpanName:     DefaultFormatSpanName,
 		StartOptions: trace.StartOptions{
 			SpanKind: trace.SpanKindServer,
 		},
@@ -54,6 +126,14 @@ func WithPropagator(p propagation.Propagator) Option {
 	})
 }
 
+// WithFallbackPropagator sets the clients fallback propagator used when the
+// propagator would exceed the message attribute limit
+func WithFallbackPropagator(p propagation.Propagator) Option {
+	return Option(func(o *Options) {
+		o.FallbackPropagator = p
+	})
+}
+
 // WithStartOptions sets the clients StartOptions
 func WithStartOptions(s trace.StartOptions) Option {
 	return Option(func(o *Options) {
@@ -74,3 +154,65 @@ func WithFormatSpanName(fn FormatSpanNameFunc) Option {
 		o.FormatSpanName = fn
 	})
 }
+
+// WithLinkedSpans starts spans for messages as new root spans linked to the
+// span context propagated on the message, this can be enabled per queue by
+// giving this option to StartSpan for messages received from that queue
+func WithLinkedSpans() Option {
+	return Option(func(o *Options) {
+		o.LinkedSpans = true
+	})
+}
+
+// WithEnvelopeMode sets how message attributes are decoded from messages
+func WithEnvelopeMode(m EnvelopeMode) Option {
+	return Option(func(o *Options) {
+		o.EnvelopeMode = m
+	})
+}
+
+// WithRawMessageDelivery only uses SQS message attributes, use this for queues
+// subscribed to SNS topics with RawMessageDelivery enabled
+func WithRawMessageDelivery() Option {
+	return WithEnvelopeMode(RawMessageDelivery)
+}
+
+// WithSNSEnvelope decodes message bodies as SNS envelopes, use this for queues
+// subscribed to SNS topics without RawMessageDelivery
+func WithSNSEnvelope() Option {
+	return WithEnvelopeMode(SNSEnvelope)
+}
+
+// WithPropagationMode sets where span contexts are propagated on messages
+func WithPropagationMode(m PropagationMode) Option {
+	return Option(func(o *Options) {
+		o.PropagationMode = m
+	})
+}
+
+// WithOversizePolicy sets what happens when adding span context message
+// attributes would exceed the maximum message size
+func WithOversizePolicy(p ocaws.OversizePolicy) Option {
+	return Option(func(o *Options) {
+		o.OversizePolicy = p
+	})
+}
+
+// WithOffloader stores message bodies of messages which are too large in S3
+// using the offloader
+func WithOffloader(off *offload.Offloader) Option {
+	return Option(func(o *Options) {
+		o.Offloader = off
+	})
+}
+
+// WithAWSTraceHeader propagates span contexts in the AWSTraceHeader message
+// system attribute using the X-Ray trace header format, leaving all message
+// attributes available to your messages
+func WithAWSTraceHeader() Option {
+	return Option(func(o *Options) {
+		o.PropagationMode = SystemAttributePropagation
+		o.Propagator = xray.New()
+		o.FallbackPropagator = nil
+	})
+}
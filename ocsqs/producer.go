@@ -0,0 +1,353 @@
+package ocsqs
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.krak3n.codes/ocaws"
+	"go.opencensus.io/trace"
+)
+
+// Producer defaults
+const (
+	DefaultLinger       = 10 * time.Millisecond
+	DefaultMaxInFlight  = 4
+	MaxSendBatchSize    = 10
+	MaxSendBatchPayload = ocaws.MaxMessageSize
+)
+
+// ErrProducerClosed is returned when sending a message after the Producer has
+// been closed
+var ErrProducerClosed = errors.New("ocsqs: producer closed")
+
+// A ProducerOption customizes a Producer
+type ProducerOption func(*Producer)
+
+// WithLinger sets the maximum time a message waits to be sent in a batch
+func WithLinger(d time.Duration) ProducerOption {
+	return ProducerOption(func(p *Producer) {
+		p.linger = d
+	})
+}
+
+// WithMaxInFlight sets the maximum number of batches being sent at once, once
+// reached messages are queued until a batch has been sent. Batches to FIFO
+// queues are always sent one at a time to keep the order of each message
+// group.
+func WithMaxInFlight(n int) ProducerOption {
+	return ProducerOption(func(p *Producer) {
+		p.maxInFlight = n
+	})
+}
+
+// WithSendOptions sets the options used to propagate span contexts on each
+// message, these override the options of an ocsqs.SQS client given to
+// NewProducer
+func WithSendOptions(opts ...Option) ProducerOption {
+	return ProducerOption(func(p *Producer) {
+		p.options = append(p.options, opts...)
+	})
+}
+
+// A Producer sends messages to a queue in batches. Messages are collected
+// until there are 10, the batch payload limit would be exceeded or the linger
+// time has passed since the first message was collected and then sent with a
+// single SendMessageBatch call. Batches are sent concurrently up to the
+// maximum in flight, see WithMaxInFlight. Each message is given a client span
+// started from the context it was sent with, the span context is propagated
+// on the message. Batches to FIFO queues are sent one at a time.
+type Producer struct {
+	client      sqsiface.SQSAPI
+	queueURL    string
+	linger      time.Duration
+	maxInFlight int
+	options     []Option
+
+	mtx       sync.RWMutex
+	closed    bool
+	sendC     chan *SendFuture
+	inFlightC chan struct{}
+	wg        sync.WaitGroup
+}
+
+// A SendFuture is the result of sending a message with a Producer
+type SendFuture struct {
+	entry *sqs.SendMessageBatchRequestEntry
+	span  *trace.Span
+	size  int
+
+	doneC chan struct{}
+	out   *sqs.SendMessageOutput
+	err   error
+}
+
+// Done returns a channel which is closed once the message has been sent
+func (f *SendFuture) Done() <-chan struct{} {
+	return f.doneC
+}
+
+// Wait blocks until the message has been sent or the context is done,
+// returning the result of sending the message. The message is still sent if
+// the context is done.
+func (f *SendFuture) Wait(ctx context.Context) (*sqs.SendMessageOutput, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-f.doneC:
+		return f.out, f.err
+	}
+}
+
+// resolve sets the result of the future and ends its span
+func (f *SendFuture) resolve(out *sqs.SendMessageOutput, err error) {
+	if f.span != nil {
+		if err != nil {
+			f.span.SetStatus(ocaws.TraceStatus(err))
+		} else {
+			f.span.AddAttributes(sendMessageAttributes(out.MessageId, out.MD5OfMessageBody, out.MD5OfMessageAttributes, out.SequenceNumber)...)
+		}
+
+		f.span.End()
+	}
+
+	f.out, f.err = out, err
+	close(f.doneC)
+}
+
+// NewProducer constructs and starts a new Producer for the given queue, Close
+// must be called to send outstanding messages. If the client is an ocsqs.SQS
+// client its underlying client is used as the Producer propagates span
+// contexts itself, the options of the ocsqs.SQS client are used as the
+// default send options.
+func NewProducer(client sqsiface.SQSAPI, queueURL string, opts ...ProducerOption) *Producer {
+	var options []Option
+	if s, ok := client.(*SQS); ok {
+		client = s.SQSAPI
+		options = append(options, s.options...)
+	}
+
+	p := &Producer{
+		client:      client,
+		queueURL:    queueURL,
+		linger:      DefaultLinger,
+		maxInFlight: DefaultMaxInFlight,
+		options:     options,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	// Concurrent batches to a FIFO queue could reorder a message group
+	if p.maxInFlight < 1 || isFIFO(queueURL) {
+		p.maxInFlight = 1
+	}
+
+	p.sendC = make(chan *SendFuture, MaxSendBatchSize)
+	p.inFlightC = make(chan struct{}, p.maxInFlight)
+
+	p.wg.Add(1)
+	go p.run()
+
+	return p
+}
+
+// Send queues the entry to be sent in the next batch returning a future
+// holding the result. A client span is started from the context and its span
+// context added to the entry. The entry Id is set by the Producer. Send blocks
+// while the queue is full, the future holds the context error if the context
+// is done before the entry is queued.
+func (p *Producer) Send(ctx context.Context, entry *sqs.SendMessageBatchRequestEntry) *SendFuture {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// Span context is added to copies of the attributes as the callers maps
+	// may be shared between messages
+	e := *entry
+	e.MessageAttributes = copyMessageAttributes(entry.MessageAttributes)
+	e.MessageSystemAttributes = copyMessageSystemAttributes(entry.MessageSystemAttributes)
+
+	ctx, span := startSendSpan(ctx, SendMessageBatchRequestEntrySpanName, aws.String(p.queueURL))
+	span.AddAttributes(fifoAttributes(e.MessageGroupId, e.MessageDeduplicationId)...)
+
+	f := &SendFuture{
+		entry: &e,
+		span:  span,
+		doneC: make(chan struct{}),
+	}
+
+	if _, err := sendMessageBatchRequestEntryWithSpan(ctx, aws.String(p.queueURL), f.entry, p.options...); err != nil {
+		f.resolve(nil, err)
+		record(ctx, p.queueURL, ocaws.OutcomeError, MessagesSent.M(1))
+
+		return f
+	}
+
+	f.size = ocaws.MessageSize(f.entry.MessageBody, f.entry.MessageAttributes)
+
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	if p.closed {
+		f.resolve(nil, ErrProducerClosed)
+		record(ctx, p.queueURL, ocaws.OutcomeError, MessagesSent.M(1))
+
+		return f
+	}
+
+	select {
+	case <-ctx.Done():
+		f.resolve(nil, ctx.Err())
+		record(ctx, p.queueURL, ocaws.OutcomeError, MessagesSent.M(1))
+	case p.sendC <- f:
+	}
+
+	return f
+}
+
+// Close sends outstanding messages and stops the Producer, waiting for
+// batches in flight. Subsequent calls to Send return ErrProducerClosed.
+func (p *Producer) Close() error {
+	p.mtx.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.sendC)
+	}
+	p.mtx.Unlock()
+
+	p.wg.Wait()
+
+	return nil
+}
+
+// run collects messages sending them when the batch is full or the linger
+// time has passed since the first message in the batch. Batches are sent in
+// their own goroutine, run waits while the maximum number of batches are in
+// flight.
+func (p *Producer) run() {
+	defer p.wg.Done()
+
+	var (
+		batch  []*SendFuture
+		size   int
+		timer  *time.Timer
+		timerC <-chan time.Time
+	)
+
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, timerC = nil, nil
+		}
+
+		p.inFlightC <- struct{}{}
+		p.wg.Add(1)
+
+		go func(batch []*SendFuture) {
+			defer func() {
+				<-p.inFlightC
+				p.wg.Done()
+			}()
+
+			p.flush(batch)
+		}(batch)
+
+		batch, size = nil, 0
+	}
+
+	for {
+		select {
+		case f, ok := <-p.sendC:
+			if !ok {
+				if len(batch) > 0 {
+					flush()
+				}
+
+				return
+			}
+
+			if len(batch) > 0 && size+f.size > MaxSendBatchPayload {
+				flush()
+			}
+
+			batch = append(batch, f)
+			size += f.size
+
+			if len(batch) == 1 {
+				timer = time.NewTimer(p.linger)
+				timerC = timer.C
+			}
+
+			if len(batch) == MaxSendBatchSize {
+				flush()
+			}
+		case <-timerC:
+			flush()
+		}
+	}
+}
+
+// flush sends the batch of messages resolving each future with its result
+func (p *Producer) flush(batch []*SendFuture) {
+	entries := make([]*sqs.SendMessageBatchRequestEntry, len(batch))
+	for i, f := range batch {
+		f.entry.Id = aws.String(strconv.Itoa(i))
+		entries[i] = f.entry
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+
+	out, err := p.client.SendMessageBatchWithContext(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(p.queueURL),
+		Entries:  entries,
+	})
+
+	recordSendMessageBatch(ctx, p.queueURL, start, len(entries), out, err)
+
+	if err != nil {
+		for _, f := range batch {
+			f.resolve(nil, err)
+		}
+
+		return
+	}
+
+	successful := make(map[string]*sqs.SendMessageBatchResultEntry)
+	for _, entry := range out.Successful {
+		successful[aws.StringValue(entry.Id)] = entry
+	}
+
+	failed := make(map[string]*sqs.BatchResultErrorEntry)
+	for _, entry := range out.Failed {
+		failed[aws.StringValue(entry.Id)] = entry
+	}
+
+	for i, f := range batch {
+		id := strconv.Itoa(i)
+
+		switch {
+		case failed[id] != nil:
+			f.resolve(nil, awserr.New(aws.StringValue(failed[id].Code), aws.StringValue(failed[id].Message), nil))
+		case successful[id] != nil:
+			entry := successful[id]
+			f.resolve(&sqs.SendMessageOutput{
+				MessageId:                    entry.MessageId,
+				MD5OfMessageBody:             entry.MD5OfMessageBody,
+				MD5OfMessageAttributes:       entry.MD5OfMessageAttributes,
+				MD5OfMessageSystemAttributes: entry.MD5OfMessageSystemAttributes,
+				SequenceNumber:               entry.SequenceNumber,
+			}, nil)
+		default:
+			f.resolve(nil, errors.New("ocsqs: no result for batch entry"))
+		}
+	}
+}
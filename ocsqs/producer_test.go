@@ -0,0 +1,408 @@
+package ocsqs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.krak3n.codes/ocaws/propagation/b3"
+	"go.krak3n.codes/ocaws/propagation/xray"
+	"go.opencensus.io/trace"
+)
+
+// batchOutput returns a batch output with every entry successful, the message
+// id of each entry is its message body
+func batchOutput(in *sqs.SendMessageBatchInput) *sqs.SendMessageBatchOutput {
+	out := &sqs.SendMessageBatchOutput{}
+	for _, entry := range in.Entries {
+		out.Successful = append(out.Successful, &sqs.SendMessageBatchResultEntry{
+			Id:        entry.Id,
+			MessageId: entry.MessageBody,
+		})
+	}
+
+	return out
+}
+
+func TestProducer_Send(t *testing.T) {
+	var calls int32
+
+	client := &TestSQS{
+		SendMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+			atomic.AddInt32(&calls, 1)
+
+			assert.Equal(t, "foo", aws.StringValue(in.QueueUrl))
+			assert.Len(t, in.Entries, MaxSendBatchSize)
+
+			for _, entry := range in.Entries {
+				assert.Contains(t, entry.MessageAttributes, b3.SpanIDKey)
+			}
+
+			return batchOutput(in), nil
+		},
+	}
+
+	// The linger time is never reached so batches are only sent when full
+	p := NewProducer(client, "foo", WithLinger(time.Hour))
+	defer p.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < MaxSendBatchSize; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ctx, span := trace.StartSpan(context.Background(), fmt.Sprint(t.Name(), i))
+			defer span.End()
+
+			out, err := p.Send(ctx, &sqs.SendMessageBatchRequestEntry{
+				MessageBody: aws.String(fmt.Sprint(i)),
+			}).Wait(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprint(i), aws.StringValue(out.MessageId))
+		}(i)
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestProducer_Send_sharedAttributes(t *testing.T) {
+	type TestCase struct {
+		tName string
+		opts  []Option
+		key   func(*sqs.SendMessageBatchRequestEntry) bool
+	}
+	tt := []TestCase{
+		{
+			tName: "message attributes",
+			key: func(entry *sqs.SendMessageBatchRequestEntry) bool {
+				_, ok := entry.MessageAttributes[b3.SpanIDKey]
+				return ok
+			},
+		},
+		{
+			tName: "message system attributes",
+			opts:  []Option{WithAWSTraceHeader()},
+			key: func(entry *sqs.SendMessageBatchRequestEntry) bool {
+				_, ok := entry.MessageSystemAttributes[xray.TraceHeaderKey]
+				return ok
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			client := &TestSQS{
+				SendMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+					for _, entry := range in.Entries {
+						assert.True(t, tc.key(entry))
+					}
+
+					return batchOutput(in), nil
+				},
+			}
+
+			p := NewProducer(client, "foo", WithLinger(time.Millisecond), WithSendOptions(tc.opts...))
+			defer p.Close()
+
+			// Every message is sent with the same attribute maps
+			attrs := map[string]*sqs.MessageAttributeValue{
+				"Foo": &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String("bar"),
+				},
+			}
+			sysAttrs := map[string]*sqs.MessageSystemAttributeValue{}
+
+			var wg sync.WaitGroup
+			for i := 0; i < MaxSendBatchSize*2; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					ctx, span := trace.StartSpan(context.Background(), fmt.Sprint(t.Name(), i))
+					defer span.End()
+
+					_, err := p.Send(ctx, &sqs.SendMessageBatchRequestEntry{
+						MessageBody:             aws.String(fmt.Sprint(i)),
+						MessageAttributes:       attrs,
+						MessageSystemAttributes: sysAttrs,
+					}).Wait(context.Background())
+					assert.NoError(t, err)
+				}(i)
+			}
+
+			wg.Wait()
+
+			assert.Len(t, attrs, 1)
+			assert.Contains(t, attrs, "Foo")
+			assert.Empty(t, sysAttrs)
+		})
+	}
+}
+
+func TestNewProducer_sqsOptions(t *testing.T) {
+	type TestCase struct {
+		tName  string
+		opts   []ProducerOption
+		system bool
+	}
+	tt := []TestCase{
+		{
+			tName:  "client options",
+			system: true,
+		},
+		{
+			tName: "send options override client options",
+			opts: []ProducerOption{
+				WithSendOptions(WithPropagator(b3.New()), WithPropagationMode(MessageAttributePropagation)),
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			client := &TestSQS{
+				SendMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+					require.Len(t, in.Entries, 1)
+
+					_, ok := in.Entries[0].MessageSystemAttributes[xray.TraceHeaderKey]
+					assert.Equal(t, tc.system, ok)
+
+					_, ok = in.Entries[0].MessageAttributes[b3.SpanIDKey]
+					assert.Equal(t, !tc.system, ok)
+
+					return batchOutput(in), nil
+				},
+			}
+
+			p := NewProducer(New(client, WithAWSTraceHeader()), "foo", append(tc.opts, WithLinger(time.Millisecond))...)
+			defer p.Close()
+
+			ctx, span := trace.StartSpan(context.Background(), t.Name())
+			defer span.End()
+
+			_, err := p.Send(ctx, &sqs.SendMessageBatchRequestEntry{MessageBody: aws.String("foo")}).Wait(context.Background())
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestProducer_Send_errors(t *testing.T) {
+	type TestCase struct {
+		tName string
+		out   *sqs.SendMessageBatchOutput
+		err   error
+		want  error
+	}
+	tt := []TestCase{
+		{
+			tName: "entry failed",
+			out: &sqs.SendMessageBatchOutput{
+				Failed: []*sqs.BatchResultErrorEntry{
+					{Id: aws.String("0"), Code: aws.String("Foo"), Message: aws.String("boom")},
+				},
+			},
+			want: awserr.New("Foo", "boom", nil),
+		},
+		{
+			tName: "batch error",
+			err:   errors.New("boom"),
+			want:  errors.New("boom"),
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			client := &TestSQS{
+				SendMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+					return tc.out, tc.err
+				},
+			}
+
+			p := NewProducer(client, "foo", WithLinger(time.Millisecond))
+			defer p.Close()
+
+			_, err := p.Send(context.Background(), &sqs.SendMessageBatchRequestEntry{
+				MessageBody: aws.String("foo"),
+			}).Wait(context.Background())
+			assert.Equal(t, tc.want, err)
+		})
+	}
+}
+
+func TestProducer_Send_batchPayload(t *testing.T) {
+	var calls int32
+
+	client := &TestSQS{
+		SendMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+			atomic.AddInt32(&calls, 1)
+			assert.Len(t, in.Entries, 1)
+
+			return batchOutput(in), nil
+		},
+	}
+
+	p := NewProducer(client, "foo", WithLinger(time.Hour))
+
+	body := aws.String(strings.Repeat("a", MaxSendBatchPayload/2))
+
+	f1 := p.Send(context.Background(), &sqs.SendMessageBatchRequestEntry{MessageBody: body})
+	f2 := p.Send(context.Background(), &sqs.SendMessageBatchRequestEntry{MessageBody: body})
+
+	// The first message is sent once the second would exceed the payload
+	// limit, the second once the producer is closed
+	_, err := f1.Wait(context.Background())
+	require.NoError(t, err)
+
+	require.NoError(t, p.Close())
+
+	_, err = f2.Wait(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestProducer_Send_inFlight(t *testing.T) {
+	var calls int32
+	sendingC := make(chan struct{})
+	releaseC := make(chan struct{})
+
+	client := &TestSQS{
+		SendMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				close(sendingC)
+				<-releaseC
+			}
+
+			return batchOutput(in), nil
+		},
+	}
+
+	p := NewProducer(client, "foo", WithLinger(time.Millisecond))
+	defer p.Close()
+
+	slow := p.Send(context.Background(), &sqs.SendMessageBatchRequestEntry{MessageBody: aws.String("slow")})
+	<-sendingC
+
+	// The second batch is sent while the first is still in flight
+	out, err := p.Send(context.Background(), &sqs.SendMessageBatchRequestEntry{MessageBody: aws.String("fast")}).Wait(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "fast", aws.StringValue(out.MessageId))
+
+	close(releaseC)
+
+	out, err = slow.Wait(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "slow", aws.StringValue(out.MessageId))
+}
+
+func TestProducer_Send_fifo(t *testing.T) {
+	sendingC := make(chan struct{})
+	releaseC := make(chan struct{})
+
+	var calls int32
+
+	client := &TestSQS{
+		SendMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+			if atomic.AddInt32(&calls, 1) == 1 {
+				close(sendingC)
+				<-releaseC
+			}
+
+			return batchOutput(in), nil
+		},
+	}
+
+	p := NewProducer(client, "foo.fifo", WithLinger(time.Millisecond), WithMaxInFlight(4))
+	defer p.Close()
+
+	first := p.Send(context.Background(), &sqs.SendMessageBatchRequestEntry{
+		MessageBody:    aws.String("first"),
+		MessageGroupId: aws.String("group"),
+	})
+	<-sendingC
+
+	// The second batch waits for the first to be sent
+	second := p.Send(context.Background(), &sqs.SendMessageBatchRequestEntry{
+		MessageBody:    aws.String("second"),
+		MessageGroupId: aws.String("group"),
+	})
+
+	select {
+	case <-second.Done():
+		t.Error("second batch sent while first in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(releaseC)
+
+	for _, f := range []*SendFuture{first, second} {
+		_, err := f.Wait(context.Background())
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestProducer_Send_cancelled(t *testing.T) {
+	releaseC := make(chan struct{})
+
+	client := &TestSQS{
+		SendMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+			<-releaseC
+			return batchOutput(in), nil
+		},
+	}
+
+	// Batches are only sent when full and one at a time
+	p := NewProducer(client, "foo", WithLinger(time.Hour), WithMaxInFlight(1))
+	defer p.Close()
+
+	// Fill the batch in flight, the batch waiting to be sent and the queue
+	var futures []*SendFuture
+	for i := 0; i < MaxSendBatchSize*3; i++ {
+		futures = append(futures, p.Send(context.Background(), &sqs.SendMessageBatchRequestEntry{
+			MessageBody: aws.String(fmt.Sprint(i)),
+		}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := p.Send(ctx, &sqs.SendMessageBatchRequestEntry{MessageBody: aws.String("foo")}).Wait(context.Background())
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(releaseC)
+
+	for _, f := range futures {
+		_, err := f.Wait(context.Background())
+		assert.NoError(t, err)
+	}
+}
+
+func TestProducer_Close(t *testing.T) {
+	p := NewProducer(&TestSQS{}, "foo")
+	require.NoError(t, p.Close())
+
+	_, err := p.Send(context.Background(), &sqs.SendMessageBatchRequestEntry{}).Wait(context.Background())
+	assert.Equal(t, ErrProducerClosed, err)
+}
@@ -0,0 +1,148 @@
+package ocsqs
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.opencensus.io/trace"
+)
+
+// Retry policy defaults
+const (
+	DefaultRetryBaseDelay = time.Second
+	DefaultRetryMaxDelay  = 15 * time.Minute
+
+	// MaxVisibilityTimeout is the maximum visibility timeout SQS allows
+	MaxVisibilityTimeout = 12 * time.Hour
+)
+
+// A RetryPolicy delays messages which failed to be handled by changing their
+// visibility timeout using exponential backoff with full jitter based on the
+// number of times the message has been received.
+type RetryPolicy struct {
+	// BaseDelay is the delay before the second attempt, each subsequent
+	// attempt doubles the delay
+	BaseDelay time.Duration
+
+	// MaxDelay caps the delay between attempts
+	MaxDelay time.Duration
+
+	// MaxAttempts should be the maxReceiveCount of the queues redrive
+	// policy, the final attempt is annotated on the span and if it fails the
+	// message is made visible immediately so it is moved to the dead letter
+	// queue. Zero means there is no limit.
+	MaxAttempts int64
+}
+
+// DefaultRetryPolicy returns a retry policy with sane defaults and no maximum
+// number of attempts
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		BaseDelay: DefaultRetryBaseDelay,
+		MaxDelay:  DefaultRetryMaxDelay,
+	}
+}
+
+// Backoff returns the delay before the attempt after the given attempt, this
+// is a random duration between zero and the exponential delay for the attempt
+func (p *RetryPolicy) Backoff(attempt int64) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	max := p.MaxDelay
+	if max <= 0 || max > MaxVisibilityTimeout {
+		max = MaxVisibilityTimeout
+	}
+
+	delay := max
+	if exp := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1)); exp < float64(max) {
+		delay = time.Duration(exp)
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// IsFinalAttempt returns true if the attempt is the last before the message
+// is moved to the dead letter queue
+func (p *RetryPolicy) IsFinalAttempt(attempt int64) bool {
+	return p.MaxAttempts > 0 && attempt >= p.MaxAttempts
+}
+
+// Annotate annotates the span with the attempt number of the message and
+// whether it is the final attempt
+func (p *RetryPolicy) Annotate(span *trace.Span, msg *sqs.Message) {
+	if span == nil {
+		return
+	}
+
+	attempt := ReceiveCount(msg)
+
+	span.Annotate([]trace.Attribute{
+		trace.Int64Attribute(AttemptAttribute, attempt),
+		trace.BoolAttribute(FinalAttemptAttribute, p.IsFinalAttempt(attempt)),
+	}, "Message receive attempt")
+}
+
+// Retry changes the visibility timeout of a message which failed to be
+// handled to the backoff for its attempt, annotating the span in the context
+// with the delay
+func (p *RetryPolicy) Retry(ctx context.Context, client sqsiface.SQSAPI, queueURL string, msg *sqs.Message) error {
+	attempt := ReceiveCount(msg)
+
+	var timeout int64
+	if !p.IsFinalAttempt(attempt) {
+		timeout = int64(math.Ceil(p.Backoff(attempt).Seconds()))
+	}
+
+	_, err := client.ChangeMessageVisibilityWithContext(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(queueURL),
+		ReceiptHandle:     msg.ReceiptHandle,
+		VisibilityTimeout: aws.Int64(timeout),
+	})
+
+	if span := trace.FromContext(ctx); span != nil {
+		attrs := []trace.Attribute{
+			trace.Int64Attribute(AttemptAttribute, attempt),
+			trace.Int64Attribute(VisibilityTimeoutAttribute, timeout),
+		}
+
+		switch {
+		case err != nil:
+			span.Annotate(attrs, "Failed to delay message retry: "+err.Error())
+		case p.IsFinalAttempt(attempt):
+			span.Annotate(attrs, "Final attempt failed: message will be moved to the dead letter queue")
+		default:
+			span.Annotate(attrs, "Message retry delayed")
+		}
+	}
+
+	return err
+}
+
+// ReceiveCount returns the number of times a message has been received from
+// the ApproximateReceiveCount system attribute, zero is returned if the
+// attribute was not requested when receiving the message
+func ReceiveCount(msg *sqs.Message) int64 {
+	v := msg.Attributes[sqs.MessageSystemAttributeNameApproximateReceiveCount]
+	if v == nil {
+		return 0
+	}
+
+	n, err := strconv.ParseInt(*v, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	return n
+}
@@ -0,0 +1,187 @@
+package ocsqs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/trace"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	type TestCase struct {
+		tName   string
+		policy  *RetryPolicy
+		attempt int64
+		max     time.Duration
+	}
+	tt := []TestCase{
+		{
+			tName:   "no attempts",
+			policy:  DefaultRetryPolicy(),
+			attempt: 0,
+			max:     time.Second,
+		},
+		{
+			tName:   "first attempt",
+			policy:  DefaultRetryPolicy(),
+			attempt: 1,
+			max:     time.Second,
+		},
+		{
+			tName:   "exponential",
+			policy:  DefaultRetryPolicy(),
+			attempt: 4,
+			max:     8 * time.Second,
+		},
+		{
+			tName:   "max delay",
+			policy:  DefaultRetryPolicy(),
+			attempt: 100,
+			max:     DefaultRetryMaxDelay,
+		},
+		{
+			tName:   "max visibility timeout",
+			policy:  &RetryPolicy{BaseDelay: time.Hour},
+			attempt: 10,
+			max:     MaxVisibilityTimeout,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			for i := 0; i < 100; i++ {
+				d := tc.policy.Backoff(tc.attempt)
+				assert.True(t, d >= 0 && d <= tc.max, "%s not between 0 and %s", d, tc.max)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Retry(t *testing.T) {
+	type TestCase struct {
+		tName      string
+		count      string
+		timeout    func(int64) bool
+		annotation string
+	}
+	tt := []TestCase{
+		{
+			tName: "retry",
+			count: "2",
+			timeout: func(n int64) bool {
+				return n >= 0 && n <= 2
+			},
+			annotation: "Message retry delayed",
+		},
+		{
+			tName: "final attempt",
+			count: "3",
+			timeout: func(n int64) bool {
+				return n == 0
+			},
+			annotation: "Final attempt failed: message will be moved to the dead letter queue",
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			client := &TestSQS{
+				ChangeMessageVisibilityWithContextFunc: func(ctx aws.Context, in *sqs.ChangeMessageVisibilityInput, opts ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+					assert.Equal(t, "foo", aws.StringValue(in.QueueUrl))
+					assert.Equal(t, "bar", aws.StringValue(in.ReceiptHandle))
+					assert.True(t, tc.timeout(aws.Int64Value(in.VisibilityTimeout)))
+
+					return &sqs.ChangeMessageVisibilityOutput{}, nil
+				},
+			}
+
+			msg := &sqs.Message{
+				ReceiptHandle: aws.String("bar"),
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String(tc.count),
+				},
+			}
+
+			policy := DefaultRetryPolicy()
+			policy.MaxAttempts = 3
+
+			ctx, span := trace.StartSpan(context.Background(), t.Name(), trace.WithSampler(trace.AlwaysSample()))
+
+			require.NoError(t, policy.Retry(ctx, client, "foo", msg))
+
+			span.End()
+
+			sd, ok := exporter.Span(t.Name())
+			require.True(t, ok)
+			require.Len(t, sd.Annotations, 1)
+			assert.Equal(t, tc.annotation, sd.Annotations[0].Message)
+		})
+	}
+}
+
+func TestRetryPolicy_Annotate(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 2}
+
+	_, span := trace.StartSpan(context.Background(), t.Name(), trace.WithSampler(trace.AlwaysSample()))
+	policy.Annotate(span, &sqs.Message{
+		Attributes: map[string]*string{
+			sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String("2"),
+		},
+	})
+	span.End()
+
+	sd, ok := exporter.Span(t.Name())
+	require.True(t, ok)
+	require.Len(t, sd.Annotations, 1)
+	assert.Equal(t, int64(2), sd.Annotations[0].Attributes[AttemptAttribute])
+	assert.Equal(t, true, sd.Annotations[0].Attributes[FinalAttemptAttribute])
+}
+
+func TestReceiveCount(t *testing.T) {
+	type TestCase struct {
+		tName string
+		msg   *sqs.Message
+		count int64
+	}
+	tt := []TestCase{
+		{
+			tName: "not requested",
+			msg:   &sqs.Message{},
+		},
+		{
+			tName: "invalid",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String("foo"),
+				},
+			},
+		},
+		{
+			tName: "received",
+			msg: &sqs.Message{
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameApproximateReceiveCount: aws.String("5"),
+				},
+			},
+			count: 5,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.count, ReceiveCount(tc.msg))
+		})
+	}
+}
@@ -1,33 +1,184 @@
 package ocsqs // import "go.krak3n.codes/ocaws/ocsqs"
 
 import (
+	"context"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"go.krak3n.codes/ocaws"
+	"go.opencensus.io/trace"
 )
 
 // SQS provides methods for sending messages with trace attributes and starting
-// spans from messages. It embeds the SQS client allowing this to be used as
-// a drop in replacement.
+// spans from messages. It embeds the SQS API interface allowing this to be used
+// as a drop in replacement for the SQS client or any other implementation of
+// sqsiface.SQSAPI.
 type SQS struct {
-	*sqs.SQS
+	sqsiface.SQSAPI
 
 	options []Option
 }
 
+// SQS implements the sqsiface.SQSAPI interface
+var _ sqsiface.SQSAPI = (*SQS)(nil)
+
 // New constructs a new SQS client with default configuration values. Use
 // Option functions to customize configuration. By default the propagator used
 // is B3.
-func New(client *sqs.SQS, opts ...Option) *SQS {
+func New(client sqsiface.SQSAPI, opts ...Option) *SQS {
 	return &SQS{
 		client,
 		opts,
 	}
 }
 
-// SendMessageWithContext shadows the sqs clients SendMessageWithContext adding trace span data to
-// the send message input
+// SendMessageWithContext shadows the sqs clients SendMessageWithContext
+// starting a client span around the send and adding its span data to the send
+// message input. The message sent and send latency are recorded.
 func (s *SQS) SendMessageWithContext(ctx aws.Context, input *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
-	input = SendMessageInputWithSpan(ctx, input, s.options...)
-	return s.SQS.SendMessageWithContext(ctx, input, opts...)
+	start := time.Now()
+
+	ctx, span := startSendSpan(ctx, SendMessageSpanName, input.QueueUrl)
+	defer span.End()
+
+	span.AddAttributes(fifoAttributes(input.MessageGroupId, input.MessageDeduplicationId)...)
+
+	input, err := sendMessageInputWithSpan(ctx, input, s.options...)
+	if err != nil {
+		span.SetStatus(ocaws.TraceStatus(err))
+		record(ctx, aws.StringValue(input.QueueUrl), ocaws.OutcomeError, MessagesSent.M(1))
+
+		return nil, err
+	}
+
+	out, err := s.SQSAPI.SendMessageWithContext(ctx, input, opts...)
+	record(ctx, aws.StringValue(input.QueueUrl), ocaws.Outcome(err), MessagesSent.M(1), SendLatency.M(sinceInMilliseconds(start)))
+
+	if err != nil {
+		span.SetStatus(ocaws.TraceStatus(err))
+		return out, err
+	}
+
+	span.AddAttributes(sendMessageAttributes(out.MessageId, out.MD5OfMessageBody, out.MD5OfMessageAttributes, out.SequenceNumber)...)
+
+	return out, err
+}
+
+// ReceiveMessageWithContext shadows the sqs clients ReceiveMessageWithContext
+// ensuring all message attributes are requested so span contexts can be
+// extracted from the received messages.
+func (s *SQS) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	input = ReceiveMessageInputWithAttributeNames(input)
+	return s.SQSAPI.ReceiveMessageWithContext(ctx, input, opts...)
+}
+
+// A Message pairs a received SQS message with a context holding the remote
+// span context extracted from the message, see WithContext.
+type Message struct {
+	*sqs.Message
+
+	// Context holds the span context propagated on the message, use this
+	// context to start spans for the message
+	Context context.Context
+}
+
+// ReceiveTracedMessagesWithContext receives messages the same as
+// ReceiveMessageWithContext but returns each message paired with a context
+// holding the span context extracted from the message by the propagator. The
+// number of messages received is recorded.
+func (s *SQS) ReceiveTracedMessagesWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput, opts ...request.Option) ([]*Message, error) {
+	out, err := s.ReceiveMessageWithContext(ctx, input, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	record(ctx, aws.StringValue(input.QueueUrl), ocaws.OutcomeOK, MessagesReceived.M(int64(len(out.Messages))))
+
+	msgs := make([]*Message, len(out.Messages))
+	for i, msg := range out.Messages {
+		msgs[i] = &Message{
+			Message: msg,
+			Context: WithContext(ctx, msg, s.options...),
+		}
+	}
+
+	return msgs, nil
+}
+
+// SendMessageBatchWithContext shadows the sqs clients SendMessageBatchWithContext
+// starting a client span for each entry and adding its span data to the entry
+// message attributes. The entry spans are ended once the batch has been sent,
+// entries which failed to send will have their span status set. If any entry
+// is rejected by the oversize policy the batch is not sent. The messages sent
+// by outcome and the send latency are recorded.
+func (s *SQS) SendMessageBatchWithContext(ctx aws.Context, input *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	var rerr error
+
+	start := time.Now()
+
+	spans := make([]*trace.Span, len(input.Entries))
+	for i, entry := range input.Entries {
+		ectx, span := startSendSpan(ctx, SendMessageBatchRequestEntrySpanName, input.QueueUrl)
+		if entry.Id != nil {
+			span.AddAttributes(trace.StringAttribute(BatchEntryIDAttribute, *entry.Id))
+		}
+
+		span.AddAttributes(fifoAttributes(entry.MessageGroupId, entry.MessageDeduplicationId)...)
+
+		if _, err := sendMessageBatchRequestEntryWithSpan(ectx, input.QueueUrl, entry, s.options...); err != nil && rerr == nil {
+			rerr = err
+		}
+
+		spans[i] = span
+	}
+
+	if rerr != nil {
+		endSendMessageBatchSpans(input, spans, nil, rerr)
+		record(ctx, aws.StringValue(input.QueueUrl), ocaws.OutcomeError, MessagesSent.M(int64(len(input.Entries))))
+
+		return nil, rerr
+	}
+
+	out, err := s.SQSAPI.SendMessageBatchWithContext(ctx, input, opts...)
+
+	endSendMessageBatchSpans(input, spans, out, err)
+	recordSendMessageBatch(ctx, aws.StringValue(input.QueueUrl), start, len(input.Entries), out, err)
+
+	return out, err
+}
+
+// endSendMessageBatchSpans ends the spans started for each batch request entry
+// recording the result of each entry on its span
+func endSendMessageBatchSpans(input *sqs.SendMessageBatchInput, spans []*trace.Span, out *sqs.SendMessageBatchOutput, err error) {
+	successful := make(map[string]*sqs.SendMessageBatchResultEntry)
+	failed := make(map[string]*sqs.BatchResultErrorEntry)
+
+	if out != nil {
+		for _, entry := range out.Successful {
+			successful[aws.StringValue(entry.Id)] = entry
+		}
+
+		for _, entry := range out.Failed {
+			failed[aws.StringValue(entry.Id)] = entry
+		}
+	}
+
+	for i, span := range spans {
+		id := aws.StringValue(input.Entries[i].Id)
+
+		switch {
+		case err != nil:
+			span.SetStatus(ocaws.TraceStatus(err))
+		case failed[id] != nil:
+			span.SetStatus(batchResultErrorStatus(failed[id]))
+		case successful[id] != nil:
+			entry := successful[id]
+			span.AddAttributes(sendMessageAttributes(entry.MessageId, entry.MD5OfMessageBody, entry.MD5OfMessageAttributes, entry.SequenceNumber)...)
+		}
+
+		span.End()
+	}
 }
@@ -183,3 +183,37 @@ func ExampleWithContext() {
 	// SpanID: 6162636465666768
 	// Span Sampled: false
 }
+
+func ExampleStartSpanFromContext() {
+	// Create a message with trace attributes, publish a message via SNS or SQS
+	msg := &sqs.Message{
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			b3.TraceIDKey: {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(ocawstest.DefaultTraceID.String()),
+			},
+			b3.SpanIDKey: {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(ocawstest.DefaultSpanID.String()),
+			},
+			b3.SpanSampledKey: {
+				DataType:    aws.String("String"),
+				StringValue: aws.String("0"),
+			},
+		},
+	}
+
+	// Defer starting the span until later
+	ctx := ocsqs.WithContext(context.Background(), msg)
+
+	ctx, span := ocsqs.StartSpanFromContext(ctx, "my.span/Name")
+	defer span.End()
+
+	sc := span.SpanContext()
+	fmt.Println("TraceID:", sc.TraceID.String())
+	fmt.Println("Span Sampled:", sc.IsSampled())
+
+	// Output:
+	// TraceID: 616263646566676869676b6c6d6e6f71
+	// Span Sampled: false
+}
@@ -1,21 +1,189 @@
 package ocsqs
 
 import (
+	"context"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.krak3n.codes/ocaws"
 	"go.krak3n.codes/ocaws/ocawstest"
+	"go.krak3n.codes/ocaws/propagation/b3"
 	"go.opencensus.io/trace"
 )
 
+// TestSQS implements the sqsiface.SQSAPI allowing methods to be overridden
+// for testing, calling methods which are not overridden will panic
+type TestSQS struct {
+	sqsiface.SQSAPI
+
+	SendMessageWithContextFunc             func(aws.Context, *sqs.SendMessageInput, ...request.Option) (*sqs.SendMessageOutput, error)
+	SendMessageBatchWithContextFunc        func(aws.Context, *sqs.SendMessageBatchInput, ...request.Option) (*sqs.SendMessageBatchOutput, error)
+	ReceiveMessageWithContextFunc          func(aws.Context, *sqs.ReceiveMessageInput, ...request.Option) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageWithContextFunc           func(aws.Context, *sqs.DeleteMessageInput, ...request.Option) (*sqs.DeleteMessageOutput, error)
+	DeleteMessageBatchWithContextFunc      func(aws.Context, *sqs.DeleteMessageBatchInput, ...request.Option) (*sqs.DeleteMessageBatchOutput, error)
+	ChangeMessageVisibilityWithContextFunc func(aws.Context, *sqs.ChangeMessageVisibilityInput, ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error)
+	GetQueueAttributesWithContextFunc      func(aws.Context, *sqs.GetQueueAttributesInput, ...request.Option) (*sqs.GetQueueAttributesOutput, error)
+}
+
+func (t *TestSQS) SendMessageWithContext(ctx aws.Context, in *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+	return t.SendMessageWithContextFunc(ctx, in, opts...)
+}
+
+func (t *TestSQS) SendMessageBatchWithContext(ctx aws.Context, in *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+	return t.SendMessageBatchWithContextFunc(ctx, in, opts...)
+}
+
+func (t *TestSQS) ReceiveMessageWithContext(ctx aws.Context, in *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	return t.ReceiveMessageWithContextFunc(ctx, in, opts...)
+}
+
+func (t *TestSQS) DeleteMessageWithContext(ctx aws.Context, in *sqs.DeleteMessageInput, opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	return t.DeleteMessageWithContextFunc(ctx, in, opts...)
+}
+
+func (t *TestSQS) DeleteMessageBatchWithContext(ctx aws.Context, in *sqs.DeleteMessageBatchInput, opts ...request.Option) (*sqs.DeleteMessageBatchOutput, error) {
+	return t.DeleteMessageBatchWithContextFunc(ctx, in, opts...)
+}
+
+func (t *TestSQS) ChangeMessageVisibilityWithContext(ctx aws.Context, in *sqs.ChangeMessageVisibilityInput, opts ...request.Option) (*sqs.ChangeMessageVisibilityOutput, error) {
+	return t.ChangeMessageVisibilityWithContextFunc(ctx, in, opts...)
+}
+
+func (t *TestSQS) GetQueueAttributesWithContext(ctx aws.Context, in *sqs.GetQueueAttributesInput, opts ...request.Option) (*sqs.GetQueueAttributesOutput, error) {
+	return t.GetQueueAttributesWithContextFunc(ctx, in, opts...)
+}
+
+// exporter stores spans exported during tests
+var exporter = &ocawstest.TestExporter{}
+
 func TestMain(m *testing.M) {
 	trace.ApplyConfig(trace.Config{
 		IDGenerator: ocawstest.NewTestIDGenerator(),
 	})
 
+	trace.RegisterExporter(exporter)
+
 	os.Exit(m.Run())
 }
 
+func TestSQS_SendMessageWithContext(t *testing.T) {
+	client := New(&TestSQS{
+		SendMessageWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+			assert.NotNil(t, trace.FromContext(ctx))
+			assert.Contains(t, in.MessageAttributes, b3.TraceIDKey)
+			assert.Contains(t, in.MessageAttributes, ocaws.TraceQueueURL)
+
+			return &sqs.SendMessageOutput{
+				MessageId: aws.String("foo"),
+			}, nil
+		},
+	})
+
+	out, err := client.SendMessageWithContext(context.Background(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo"),
+		MessageBody: aws.String("foo"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "foo", aws.StringValue(out.MessageId))
+}
+
+func TestSQS_SendMessageWithContext_rejectOversize(t *testing.T) {
+	client := New(&TestSQS{
+		SendMessageWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+			t.Error("oversize message sent")
+			return nil, nil
+		},
+	}, WithOversizePolicy(ocaws.RejectOversize))
+
+	_, err := client.SendMessageWithContext(context.Background(), &sqs.SendMessageInput{
+		QueueUrl:    aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo"),
+		MessageBody: aws.String(strings.Repeat("a", ocaws.MaxMessageSize)),
+	})
+	require.Error(t, err)
+	assert.IsType(t, &ocaws.MessageTooLargeError{}, err)
+}
+
+func TestSQS_SendMessageBatchWithContext(t *testing.T) {
+	client := New(&TestSQS{
+		SendMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+			for _, entry := range in.Entries {
+				assert.Contains(t, entry.MessageAttributes, b3.TraceIDKey)
+				assert.Contains(t, entry.MessageAttributes, ocaws.TraceQueueURL)
+			}
+
+			return &sqs.SendMessageBatchOutput{
+				Successful: []*sqs.SendMessageBatchResultEntry{
+					{Id: aws.String("1"), MessageId: aws.String("foo")},
+				},
+				Failed: []*sqs.BatchResultErrorEntry{
+					{Id: aws.String("2"), Code: aws.String("Foo"), Message: aws.String("boom")},
+				},
+			}, nil
+		},
+	})
+
+	out, err := client.SendMessageBatchWithContext(context.Background(), &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo"),
+		Entries: []*sqs.SendMessageBatchRequestEntry{
+			{Id: aws.String("1"), MessageBody: aws.String("foo")},
+			{Id: aws.String("2"), MessageBody: aws.String("bar")},
+		},
+	})
+	require.NoError(t, err)
+	assert.Len(t, out.Successful, 1)
+	assert.Len(t, out.Failed, 1)
+}
+
+func TestSQS_ReceiveTracedMessagesWithContext(t *testing.T) {
+	client := New(&TestSQS{
+		ReceiveMessageWithContextFunc: func(ctx aws.Context, in *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+			assert.Equal(t, []*string{aws.String("All")}, in.MessageAttributeNames)
+			assert.Equal(t, []*string{aws.String("All")}, in.AttributeNames)
+
+			return &sqs.ReceiveMessageOutput{
+				Messages: []*sqs.Message{
+					{
+						MessageId: aws.String("foo"),
+						MessageAttributes: map[string]*sqs.MessageAttributeValue{
+							b3.TraceIDKey: &sqs.MessageAttributeValue{
+								DataType:    aws.String("String"),
+								StringValue: aws.String(ocawstest.DefaultTraceID.String()),
+							},
+							b3.SpanIDKey: &sqs.MessageAttributeValue{
+								DataType:    aws.String("String"),
+								StringValue: aws.String(ocawstest.DefaultSpanID.String()),
+							},
+						},
+					},
+					{
+						MessageId: aws.String("bar"),
+					},
+				},
+			}, nil
+		},
+	})
+
+	msgs, err := client.ReceiveTracedMessagesWithContext(context.Background(), &sqs.ReceiveMessageInput{
+		QueueUrl: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo"),
+	})
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+
+	sc, ok := SpanFromContext(msgs[0].Context)
+	assert.True(t, ok)
+	assert.Equal(t, ocawstest.DefaultTraceID, sc.TraceID)
+
+	_, ok = SpanFromContext(msgs[1].Context)
+	assert.False(t, ok)
+}
+
 // type SendMessageRequestFunc func(*sqs.SendMessageInput) (*request.Request, *sqs.SendMessageOutput)
 //
 // func (fn SendMessageRequestFunc) SendMessageRequest(in *sqs.SendMessageInput) (*request.Request, *sqs.SendMessageOutput) {
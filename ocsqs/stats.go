@@ -0,0 +1,192 @@
+package ocsqs
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.krak3n.codes/ocaws"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// KeyQueue is the tag holding the name of the queue
+var KeyQueue = tag.MustNewKey("sqs_queue")
+
+// Measures recorded by the SQS client, Producer, Consumer and Acknowledger
+var (
+	MessagesSent = stats.Int64(
+		"go.krak3n.codes/ocaws/sqs/messages_sent",
+		"Number of messages sent",
+		stats.UnitDimensionless)
+	SendLatency = stats.Float64(
+		"go.krak3n.codes/ocaws/sqs/send_latency",
+		"Time taken to send a message or batch of messages",
+		stats.UnitMilliseconds)
+	MessagesReceived = stats.Int64(
+		"go.krak3n.codes/ocaws/sqs/messages_received",
+		"Number of messages received",
+		stats.UnitDimensionless)
+	MessagesProcessed = stats.Int64(
+		"go.krak3n.codes/ocaws/sqs/messages_processed",
+		"Number of messages handled successfully",
+		stats.UnitDimensionless)
+	MessagesFailed = stats.Int64(
+		"go.krak3n.codes/ocaws/sqs/messages_failed",
+		"Number of messages which failed to be handled",
+		stats.UnitDimensionless)
+	ProcessLatency = stats.Float64(
+		"go.krak3n.codes/ocaws/sqs/process_latency",
+		"Time taken to handle a message",
+		stats.UnitMilliseconds)
+	DwellTime = stats.Float64(
+		"go.krak3n.codes/ocaws/sqs/dwell_time",
+		"Time between a message being sent and first received",
+		stats.UnitMilliseconds)
+	EndToEndLatency = stats.Float64(
+		"go.krak3n.codes/ocaws/sqs/end_to_end_latency",
+		"Time between a message being sent and being handled",
+		stats.UnitMilliseconds)
+	MessagesDeleted = stats.Int64(
+		"go.krak3n.codes/ocaws/sqs/messages_deleted",
+		"Number of messages deleted after being handled",
+		stats.UnitDimensionless)
+)
+
+// QueueLatencyDistribution is the distribution of latencies in milliseconds
+// used by the dwell time and end to end latency views, messages may wait in a
+// queue for much longer than a request takes so this extends to 12 hours
+var QueueLatencyDistribution = view.Distribution(1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 300000, 600000, 1800000, 3600000, 10800000, 21600000, 43200000)
+
+// Views for the measures recorded by this package
+var (
+	MessagesSentView = &view.View{
+		Name:        "go.krak3n.codes/ocaws/sqs/messages_sent",
+		Description: "Number of messages sent, by queue and outcome",
+		Measure:     MessagesSent,
+		TagKeys:     []tag.Key{KeyQueue, ocaws.KeyOutcome},
+		Aggregation: view.Sum(),
+	}
+	SendLatencyView = &view.View{
+		Name:        "go.krak3n.codes/ocaws/sqs/send_latency",
+		Description: "Latency distribution of sending messages, by queue and outcome",
+		Measure:     SendLatency,
+		TagKeys:     []tag.Key{KeyQueue, ocaws.KeyOutcome},
+		Aggregation: ocaws.DefaultLatencyDistribution,
+	}
+	MessagesReceivedView = &view.View{
+		Name:        "go.krak3n.codes/ocaws/sqs/messages_received",
+		Description: "Number of messages received, by queue",
+		Measure:     MessagesReceived,
+		TagKeys:     []tag.Key{KeyQueue},
+		Aggregation: view.Sum(),
+	}
+	MessagesProcessedView = &view.View{
+		Name:        "go.krak3n.codes/ocaws/sqs/messages_processed",
+		Description: "Number of messages handled successfully, by queue",
+		Measure:     MessagesProcessed,
+		TagKeys:     []tag.Key{KeyQueue},
+		Aggregation: view.Sum(),
+	}
+	MessagesFailedView = &view.View{
+		Name:        "go.krak3n.codes/ocaws/sqs/messages_failed",
+		Description: "Number of messages which failed to be handled, by queue",
+		Measure:     MessagesFailed,
+		TagKeys:     []tag.Key{KeyQueue},
+		Aggregation: view.Sum(),
+	}
+	ProcessLatencyView = &view.View{
+		Name:        "go.krak3n.codes/ocaws/sqs/process_latency",
+		Description: "Latency distribution of handling messages, by queue and outcome",
+		Measure:     ProcessLatency,
+		TagKeys:     []tag.Key{KeyQueue, ocaws.KeyOutcome},
+		Aggregation: ocaws.DefaultLatencyDistribution,
+	}
+	DwellTimeView = &view.View{
+		Name:        "go.krak3n.codes/ocaws/sqs/dwell_time",
+		Description: "Distribution of the time messages spend in the queue before being first received, by queue",
+		Measure:     DwellTime,
+		TagKeys:     []tag.Key{KeyQueue},
+		Aggregation: QueueLatencyDistribution,
+	}
+	EndToEndLatencyView = &view.View{
+		Name:        "go.krak3n.codes/ocaws/sqs/end_to_end_latency",
+		Description: "Distribution of the time between messages being sent and being handled, by queue",
+		Measure:     EndToEndLatency,
+		TagKeys:     []tag.Key{KeyQueue},
+		Aggregation: QueueLatencyDistribution,
+	}
+	MessagesDeletedView = &view.View{
+		Name:        "go.krak3n.codes/ocaws/sqs/messages_deleted",
+		Description: "Number of messages deleted after being handled, by queue and outcome",
+		Measure:     MessagesDeleted,
+		TagKeys:     []tag.Key{KeyQueue, ocaws.KeyOutcome},
+		Aggregation: view.Sum(),
+	}
+)
+
+// DefaultViews are the default views provided by this package
+var DefaultViews = []*view.View{
+	MessagesSentView,
+	SendLatencyView,
+	MessagesReceivedView,
+	MessagesProcessedView,
+	MessagesFailedView,
+	ProcessLatencyView,
+	DwellTimeView,
+	EndToEndLatencyView,
+	MessagesDeletedView,
+}
+
+// record records the measurements tagged with the queue name and outcome
+func record(ctx context.Context, queueURL string, outcome string, ms ...stats.Measurement) {
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(KeyQueue, queueNameFromURL(queueURL)),
+		tag.Upsert(ocaws.KeyOutcome, outcome),
+	}, ms...)
+}
+
+// recordProcess records the outcome of handling a message
+func recordProcess(ctx context.Context, queueURL string, start time.Time, err error) {
+	m := MessagesProcessed.M(1)
+	if err != nil {
+		m = MessagesFailed.M(1)
+	}
+
+	record(ctx, queueURL, ocaws.Outcome(err), m, ProcessLatency.M(sinceInMilliseconds(start)))
+}
+
+// recordSendMessageBatch records the outcome of sending a batch of messages,
+// the entries of the batch are recorded by their individual outcome
+func recordSendMessageBatch(ctx context.Context, queueURL string, start time.Time, n int, out *sqs.SendMessageBatchOutput, err error) {
+	latency := SendLatency.M(sinceInMilliseconds(start))
+
+	if err != nil {
+		record(ctx, queueURL, ocaws.OutcomeError, MessagesSent.M(int64(n)), latency)
+		return
+	}
+
+	record(ctx, queueURL, ocaws.OutcomeOK, MessagesSent.M(int64(len(out.Successful))), latency)
+
+	if len(out.Failed) > 0 {
+		record(ctx, queueURL, ocaws.OutcomeError, MessagesSent.M(int64(len(out.Failed))))
+	}
+}
+
+// queueNameFromURL returns the name of the queue from its URL
+func queueNameFromURL(queueURL string) string {
+	u, err := url.Parse(queueURL)
+	if err != nil {
+		return queueURL
+	}
+
+	return path.Base(u.Path)
+}
+
+// sinceInMilliseconds returns the time since t in milliseconds
+func sinceInMilliseconds(t time.Time) float64 {
+	return float64(time.Since(t).Nanoseconds()) / 1e6
+}
@@ -0,0 +1,183 @@
+package ocsqs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.krak3n.codes/ocaws"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// viewRow returns the data of the row of the view with the given queue and
+// outcome tags, nil is returned if there is no such row
+func viewRow(t *testing.T, v *view.View, queue, outcome string) view.AggregationData {
+	rows, err := view.RetrieveData(v.Name)
+	require.NoError(t, err)
+
+	for _, row := range rows {
+		tags := make(map[tag.Key]string)
+		for _, t := range row.Tags {
+			tags[t.Key] = t.Value
+		}
+
+		if tags[KeyQueue] != queue {
+			continue
+		}
+
+		if _, ok := tags[ocaws.KeyOutcome]; ok && tags[ocaws.KeyOutcome] != outcome {
+			continue
+		}
+
+		return row.Data
+	}
+
+	return nil
+}
+
+func TestStats(t *testing.T) {
+	require.NoError(t, view.Register(DefaultViews...))
+	defer view.Unregister(DefaultViews...)
+
+	t.Run("send", func(t *testing.T) {
+		client := New(&TestSQS{
+			SendMessageWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageInput, opts ...request.Option) (*sqs.SendMessageOutput, error) {
+				if aws.StringValue(in.MessageBody) == "fail" {
+					return nil, errors.New("boom")
+				}
+
+				return &sqs.SendMessageOutput{}, nil
+			},
+		})
+
+		for _, body := range []string{"ok", "ok", "fail"} {
+			client.SendMessageWithContext(context.Background(), &sqs.SendMessageInput{
+				QueueUrl:    aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Send"),
+				MessageBody: aws.String(body),
+			})
+		}
+
+		assert.Equal(t, float64(2), viewRow(t, MessagesSentView, "Send", ocaws.OutcomeOK).(*view.SumData).Value)
+		assert.Equal(t, float64(1), viewRow(t, MessagesSentView, "Send", ocaws.OutcomeError).(*view.SumData).Value)
+		assert.Equal(t, int64(2), viewRow(t, SendLatencyView, "Send", ocaws.OutcomeOK).(*view.DistributionData).Count)
+	})
+
+	t.Run("send batch", func(t *testing.T) {
+		client := New(&TestSQS{
+			SendMessageBatchWithContextFunc: func(ctx aws.Context, in *sqs.SendMessageBatchInput, opts ...request.Option) (*sqs.SendMessageBatchOutput, error) {
+				return &sqs.SendMessageBatchOutput{
+					Successful: []*sqs.SendMessageBatchResultEntry{{Id: aws.String("1")}},
+					Failed:     []*sqs.BatchResultErrorEntry{{Id: aws.String("2")}},
+				}, nil
+			},
+		})
+
+		client.SendMessageBatchWithContext(context.Background(), &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/SendBatch"),
+			Entries: []*sqs.SendMessageBatchRequestEntry{
+				{Id: aws.String("1"), MessageBody: aws.String("foo")},
+				{Id: aws.String("2"), MessageBody: aws.String("bar")},
+			},
+		})
+
+		assert.Equal(t, float64(1), viewRow(t, MessagesSentView, "SendBatch", ocaws.OutcomeOK).(*view.SumData).Value)
+		assert.Equal(t, float64(1), viewRow(t, MessagesSentView, "SendBatch", ocaws.OutcomeError).(*view.SumData).Value)
+		assert.Equal(t, int64(1), viewRow(t, SendLatencyView, "SendBatch", ocaws.OutcomeOK).(*view.DistributionData).Count)
+	})
+
+	t.Run("consume", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var received bool
+
+		sent := time.Now().Add(-time.Minute)
+
+		client := &TestSQS{
+			ReceiveMessageWithContextFunc: func(ctx aws.Context, in *sqs.ReceiveMessageInput, opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+				if received {
+					cancel()
+					return nil, ctx.Err()
+				}
+
+				received = true
+
+				return &sqs.ReceiveMessageOutput{
+					Messages: []*sqs.Message{
+						{
+							MessageId:     aws.String("ok"),
+							ReceiptHandle: aws.String("ok"),
+							Attributes: map[string]*string{
+								sqs.MessageSystemAttributeNameSentTimestamp:                    aws.String(timestamp(sent)),
+								sqs.MessageSystemAttributeNameApproximateFirstReceiveTimestamp: aws.String(timestamp(sent.Add(time.Second))),
+							},
+						},
+						{MessageId: aws.String("fail"), ReceiptHandle: aws.String("fail")},
+					},
+				}, nil
+			},
+			DeleteMessageWithContextFunc: func(ctx aws.Context, in *sqs.DeleteMessageInput, opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+				return &sqs.DeleteMessageOutput{}, nil
+			},
+		}
+
+		err := NewConsumer(client, "https://sqs.eu-west-1.amazonaws.com/123456789101112/Consume", WithConcurrency(2)).Consume(ctx, func(ctx context.Context, msg *sqs.Message) error {
+			if aws.StringValue(msg.MessageId) == "fail" {
+				return errors.New("boom")
+			}
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, float64(2), viewRow(t, MessagesReceivedView, "Consume", "").(*view.SumData).Value)
+		assert.Equal(t, float64(1), viewRow(t, MessagesProcessedView, "Consume", "").(*view.SumData).Value)
+		assert.Equal(t, float64(1), viewRow(t, MessagesFailedView, "Consume", "").(*view.SumData).Value)
+		assert.Equal(t, int64(1), viewRow(t, ProcessLatencyView, "Consume", ocaws.OutcomeOK).(*view.DistributionData).Count)
+		assert.Equal(t, int64(1), viewRow(t, ProcessLatencyView, "Consume", ocaws.OutcomeError).(*view.DistributionData).Count)
+		assert.Equal(t, float64(1), viewRow(t, MessagesDeletedView, "Consume", ocaws.OutcomeOK).(*view.SumData).Value)
+
+		dwell := viewRow(t, DwellTimeView, "Consume", "").(*view.DistributionData)
+		assert.Equal(t, int64(1), dwell.Count)
+		assert.Equal(t, float64(1000), dwell.Mean)
+
+		e2e := viewRow(t, EndToEndLatencyView, "Consume", "").(*view.DistributionData)
+		assert.Equal(t, int64(1), e2e.Count)
+		assert.True(t, e2e.Mean >= 60000)
+	})
+}
+
+func Test_queueNameFromURL(t *testing.T) {
+	type TestCase struct {
+		tName string
+		url   string
+		name  string
+	}
+	tt := []TestCase{
+		{
+			tName: "queue url",
+			url:   "https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo",
+			name:  "Foo",
+		},
+		{
+			tName: "name",
+			url:   "Foo",
+			name:  "Foo",
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.name, queueNameFromURL(tc.url))
+		})
+	}
+}
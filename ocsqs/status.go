@@ -0,0 +1,94 @@
+package ocsqs
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.krak3n.codes/ocaws"
+	"go.opencensus.io/trace"
+)
+
+// A PanicError is returned by handlers wrapped in RecoverMiddleware which
+// panicked, the message is not deleted so will be retried
+type PanicError struct {
+	// Value is the value the handler panicked with
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine which panicked
+	Stack []byte
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("ocsqs: handler panic: %v", e.Value)
+}
+
+// EndSpan sets the status of a message span from the error returned by the
+// handler and ends the span, see ocaws.TraceStatus for how errors are mapped
+// to status codes
+func EndSpan(span *trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(spanStatus(err))
+	}
+
+	span.End()
+}
+
+// RecoverMiddleware recovers handlers which panic returning a *PanicError
+// instead, the panic is annotated on the span in the context. Use this within
+// tracing so the span status is set from the PanicError.
+func RecoverMiddleware() Middleware {
+	return Middleware(func(next Handler) Handler {
+		return Handler(func(ctx context.Context, msg *sqs.Message) (err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					annotatePanic(trace.FromContext(ctx), v)
+
+					err = &PanicError{
+						Value: v,
+						Stack: debug.Stack(),
+					}
+				}
+			}()
+
+			return next(ctx, msg)
+		})
+	})
+}
+
+// spanStatus returns the status for a message span from a handler error,
+// panics are always internal errors
+func spanStatus(err error) trace.Status {
+	if perr, ok := err.(*PanicError); ok {
+		return trace.Status{
+			Code:    trace.StatusCodeInternal,
+			Message: perr.Error(),
+		}
+	}
+
+	return ocaws.TraceStatus(err)
+}
+
+// annotatePanic annotates the span with a value recovered from a panic
+func annotatePanic(span *trace.Span, v interface{}) {
+	if span == nil {
+		return
+	}
+
+	span.Annotate([]trace.Attribute{
+		trace.StringAttribute(PanicAttribute, fmt.Sprint(v)),
+	}, "Handler panicked")
+}
+
+// endSpanWithPanic marks the span as failing with an internal error and ends
+// it, use this when recovering a panic before re-panicking
+func endSpanWithPanic(span *trace.Span, v interface{}) {
+	annotatePanic(span, v)
+	span.SetStatus(trace.Status{
+		Code:    trace.StatusCodeInternal,
+		Message: fmt.Sprintf("ocsqs: handler panic: %v", v),
+	})
+	span.End()
+}
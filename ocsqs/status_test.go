@@ -0,0 +1,76 @@
+package ocsqs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/trace"
+)
+
+func TestEndSpan(t *testing.T) {
+	_, span := trace.StartSpan(context.Background(), t.Name(), trace.WithSampler(trace.AlwaysSample()))
+	EndSpan(span, context.DeadlineExceeded)
+
+	sd, ok := exporter.Span(t.Name())
+	require.True(t, ok)
+	assert.Equal(t, int32(trace.StatusCodeDeadlineExceeded), sd.Status.Code)
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	type TestCase struct {
+		tName string
+		mws   []Middleware
+		panic bool
+	}
+	tt := []TestCase{
+		{
+			tName: "re-panic",
+			mws: []Middleware{
+				TracingMiddleware(WithStartOptions(trace.StartOptions{Sampler: trace.AlwaysSample()})),
+			},
+			panic: true,
+		},
+		{
+			tName: "recovered",
+			mws: []Middleware{
+				TracingMiddleware(WithStartOptions(trace.StartOptions{Sampler: trace.AlwaysSample()})),
+				RecoverMiddleware(),
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			handler := Chain(func(context.Context, *sqs.Message) error {
+				panic("boom")
+			}, tc.mws...)
+
+			msg := &sqs.Message{MessageId: aws.String(t.Name())}
+
+			if tc.panic {
+				assert.PanicsWithValue(t, "boom", func() {
+					handler(context.Background(), msg)
+				})
+			} else {
+				err := handler(context.Background(), msg)
+				if assert.IsType(t, &PanicError{}, err) {
+					assert.Equal(t, "boom", err.(*PanicError).Value)
+					assert.NotEmpty(t, err.(*PanicError).Stack)
+				}
+			}
+
+			sd, ok := exporter.Span("sqs.Message/" + t.Name())
+			require.True(t, ok)
+			assert.Equal(t, int32(trace.StatusCodeInternal), sd.Status.Code)
+			assert.Equal(t, "ocsqs: handler panic: boom", sd.Status.Message)
+			require.Len(t, sd.Annotations, 1)
+			assert.Equal(t, "boom", sd.Annotations[0].Attributes[PanicAttribute])
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package ocsqs
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.krak3n.codes/ocaws"
+	"go.opencensus.io/trace"
+)
+
+// Attributes recorded on spans started by this package
+const (
+	QueueURLAttribute               = "sqs.queue_url"
+	MessageIDAttribute              = "sqs.message_id"
+	BatchEntryIDAttribute           = "sqs.batch_entry_id"
+	MD5OfMessageBodyAttribute       = "sqs.md5_of_message_body"
+	MD5OfMessageAttributesAttribute = "sqs.md5_of_message_attributes"
+	FIFOAttribute                   = "sqs.fifo"
+	MessageGroupIDAttribute         = "sqs.message_group_id"
+	MessageDeduplicationIDAttribute = "sqs.message_deduplication_id"
+	SequenceNumberAttribute         = "sqs.sequence_number"
+	MessageAttributesAttribute      = "sqs.message_attributes"
+	MessageSizeAttribute            = "sqs.message_size"
+	VisibilityTimeoutAttribute      = "sqs.visibility_timeout"
+	AttemptAttribute                = "sqs.attempt"
+	FinalAttemptAttribute           = "sqs.final_attempt"
+	PanicAttribute                  = "sqs.panic"
+	DwellTimeAttribute              = "sqs.dwell_time_ms"
+	EndToEndLatencyAttribute        = "sqs.end_to_end_latency_ms"
+)
+
+// Span names for spans started around calls to SQS
+const (
+	SendMessageSpanName                  = "sqs.SendMessage"
+	SendMessageBatchRequestEntrySpanName = "sqs.SendMessageBatchRequestEntry"
+)
+
+// startSendSpan starts a client span around sending a message to the given
+// queue, the returned context should be used to propagate the span context
+func startSendSpan(ctx context.Context, name string, queueURL *string) (context.Context, *trace.Span) {
+	ctx, span := trace.StartSpan(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	if queueURL != nil {
+		span.AddAttributes(
+			trace.StringAttribute(QueueURLAttribute, *queueURL),
+			trace.BoolAttribute(FIFOAttribute, isFIFO(*queueURL)))
+	}
+
+	return ctx, span
+}
+
+// isFIFO returns true if the queue url or name is for a FIFO queue
+func isFIFO(queue string) bool {
+	return strings.HasSuffix(queue, ".fifo")
+}
+
+// fifoAttributes returns span attributes for messages sent to FIFO queues
+func fifoAttributes(group, dedup *string) []trace.Attribute {
+	var attrs []trace.Attribute
+
+	if group != nil {
+		attrs = append(attrs, trace.StringAttribute(MessageGroupIDAttribute, *group))
+	}
+
+	if dedup != nil {
+		attrs = append(attrs, trace.StringAttribute(MessageDeduplicationIDAttribute, *dedup))
+	}
+
+	return attrs
+}
+
+// receivedMessageAttributes returns span attributes from a received message,
+// FIFO attributes are only available if requested when receiving the message
+func receivedMessageAttributes(msg *sqs.Message) []trace.Attribute {
+	var attrs []trace.Attribute
+
+	if msg.MessageId != nil {
+		attrs = append(attrs, trace.StringAttribute(MessageIDAttribute, *msg.MessageId))
+	}
+
+	if queue := queuePath(msg.MessageAttributes); queue != "" {
+		attrs = append(attrs, trace.BoolAttribute(FIFOAttribute, isFIFO(queue)))
+	}
+
+	attrs = append(attrs, fifoAttributes(
+		msg.Attributes[sqs.MessageSystemAttributeNameMessageGroupId],
+		msg.Attributes[sqs.MessageSystemAttributeNameMessageDeduplicationId])...)
+
+	if v := msg.Attributes[sqs.MessageSystemAttributeNameSequenceNumber]; v != nil {
+		attrs = append(attrs, trace.StringAttribute(SequenceNumberAttribute, *v))
+	}
+
+	return attrs
+}
+
+// sendMessageAttributes returns span attributes from a send message result
+func sendMessageAttributes(mid, md5body, md5attrs, seq *string) []trace.Attribute {
+	var attrs []trace.Attribute
+
+	if mid != nil {
+		attrs = append(attrs, trace.StringAttribute(MessageIDAttribute, *mid))
+	}
+
+	if md5body != nil {
+		attrs = append(attrs, trace.StringAttribute(MD5OfMessageBodyAttribute, *md5body))
+	}
+
+	if md5attrs != nil {
+		attrs = append(attrs, trace.StringAttribute(MD5OfMessageAttributesAttribute, *md5attrs))
+	}
+
+	if seq != nil {
+		attrs = append(attrs, trace.StringAttribute(SequenceNumberAttribute, *seq))
+	}
+
+	return attrs
+}
+
+// batchResultErrorStatus returns a trace status for a batch entry which failed
+// to be processed
+func batchResultErrorStatus(entry *sqs.BatchResultErrorEntry) trace.Status {
+	return ocaws.TraceStatus(awserr.New(aws.StringValue(entry.Code), aws.StringValue(entry.Message), nil))
+}
@@ -0,0 +1,134 @@
+package ocsqs
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"go.krak3n.codes/ocaws"
+	"go.opencensus.io/trace"
+)
+
+func Test_sendMessageAttributes(t *testing.T) {
+	type TestCase struct {
+		tName    string
+		mid      *string
+		md5body  *string
+		md5attrs *string
+		seq      *string
+		attrs    []trace.Attribute
+	}
+	tt := []TestCase{
+		{
+			tName: "nil",
+		},
+		{
+			tName:    "ok",
+			mid:      aws.String("foo"),
+			md5body:  aws.String("bar"),
+			md5attrs: aws.String("baz"),
+			seq:      aws.String("1"),
+			attrs: []trace.Attribute{
+				trace.StringAttribute(MessageIDAttribute, "foo"),
+				trace.StringAttribute(MD5OfMessageBodyAttribute, "bar"),
+				trace.StringAttribute(MD5OfMessageAttributesAttribute, "baz"),
+				trace.StringAttribute(SequenceNumberAttribute, "1"),
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.attrs, sendMessageAttributes(tc.mid, tc.md5body, tc.md5attrs, tc.seq))
+		})
+	}
+}
+
+func Test_receivedMessageAttributes(t *testing.T) {
+	type TestCase struct {
+		tName string
+		msg   *sqs.Message
+		attrs []trace.Attribute
+	}
+	tt := []TestCase{
+		{
+			tName: "empty",
+			msg:   &sqs.Message{},
+		},
+		{
+			tName: "fifo",
+			msg: &sqs.Message{
+				MessageId: aws.String("foo"),
+				MessageAttributes: map[string]*sqs.MessageAttributeValue{
+					ocaws.TraceQueueURL: &sqs.MessageAttributeValue{
+						DataType:    aws.String("String"),
+						StringValue: aws.String("https://sqs.eu-west-1.amazonaws.com/123456789101112/Foo.fifo"),
+					},
+				},
+				Attributes: map[string]*string{
+					sqs.MessageSystemAttributeNameMessageGroupId:         aws.String("bar"),
+					sqs.MessageSystemAttributeNameMessageDeduplicationId: aws.String("baz"),
+					sqs.MessageSystemAttributeNameSequenceNumber:         aws.String("1"),
+				},
+			},
+			attrs: []trace.Attribute{
+				trace.StringAttribute(MessageIDAttribute, "foo"),
+				trace.BoolAttribute(FIFOAttribute, true),
+				trace.StringAttribute(MessageGroupIDAttribute, "bar"),
+				trace.StringAttribute(MessageDeduplicationIDAttribute, "baz"),
+				trace.StringAttribute(SequenceNumberAttribute, "1"),
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.attrs, receivedMessageAttributes(tc.msg))
+		})
+	}
+}
+
+func Test_batchResultErrorStatus(t *testing.T) {
+	type TestCase struct {
+		tName  string
+		entry  *sqs.BatchResultErrorEntry
+		status trace.Status
+	}
+	tt := []TestCase{
+		{
+			tName: "unknown code",
+			entry: &sqs.BatchResultErrorEntry{
+				Code:    aws.String("Foo"),
+				Message: aws.String("boom"),
+			},
+			status: trace.Status{
+				Code:    trace.StatusCodeUnknown,
+				Message: "Foo: boom",
+			},
+		},
+		{
+			tName: "known code",
+			entry: &sqs.BatchResultErrorEntry{
+				Code:    aws.String(sqs.ErrCodeInvalidMessageContents),
+				Message: aws.String("boom"),
+			},
+			status: trace.Status{
+				Code:    trace.StatusCodeInvalidArgument,
+				Message: "InvalidMessageContents: boom",
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.status, batchResultErrorStatus(tc.entry))
+		})
+	}
+}
@@ -0,0 +1,16 @@
+/*Package offload stores message bodies too large for SQS and SNS in S3,
+replacing the body with a pointer to the S3 object. Pointers use the same
+format as the Amazon SQS Extended Client Library for Java so messages can be
+exchanged with services using it.
+
+    ["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"bucket","s3Key":"key"}]
+
+The size of the original body is sent in the ExtendedPayloadSize message
+attribute. Optional trace attributes such as the queue url or topic name are
+dropped to make room for it, ErrTooManyAttributes is only returned when the
+messages own attributes use every message attribute.
+
+Objects are not deleted once the message has been handled, use an S3 lifecycle
+rule to expire them.
+*/
+package offload // import "go.krak3n.codes/ocaws/offload"
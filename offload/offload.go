@@ -0,0 +1,260 @@
+package offload
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"go.krak3n.codes/ocaws"
+	"go.opencensus.io/trace"
+)
+
+// SizeAttribute is the message attribute holding the size of an offloaded
+// message body
+const SizeAttribute = "ExtendedPayloadSize"
+
+// ErrTooManyAttributes is returned when a message body should be offloaded but
+// the message has no message attributes available for the SizeAttribute
+var ErrTooManyAttributes = errors.New("offload: no message attribute available for the payload size")
+
+// Pointer classes written by the Java extended client libraries, the legacy
+// class is accepted when reading pointers
+const (
+	PointerClass       = "software.amazon.payloadoffloading.PayloadS3Pointer"
+	LegacyPointerClass = "com.amazon.sqs.javamessaging.MessageS3Pointer"
+)
+
+// Attributes recorded on spans started by this package
+const (
+	BucketAttribute   = "s3.bucket"
+	KeyAttribute      = "s3.key"
+	SizeSpanAttribute = "s3.size"
+)
+
+// Span names for spans started around calls to S3
+const (
+	PutObjectSpanName = "s3.PutObject"
+	GetObjectSpanName = "s3.GetObject"
+)
+
+// A Pointer locates a message body stored in S3
+type Pointer struct {
+	Bucket string `json:"s3BucketName"`
+	Key    string `json:"s3Key"`
+}
+
+// String returns the pointer as a message body
+func (p Pointer) String() string {
+	b, _ := json.Marshal([]interface{}{PointerClass, p})
+	return string(b)
+}
+
+// ParsePointer parses a message body as a pointer, false is returned if the
+// body is not a pointer
+func ParsePointer(body string) (Pointer, bool) {
+	var p Pointer
+
+	if !strings.HasPrefix(body, "[") {
+		return p, false
+	}
+
+	var v []json.RawMessage
+	if err := json.Unmarshal([]byte(body), &v); err != nil || len(v) != 2 {
+		return p, false
+	}
+
+	var class string
+	if err := json.Unmarshal(v[0], &class); err != nil {
+		return p, false
+	}
+
+	if class != PointerClass && class != LegacyPointerClass {
+		return p, false
+	}
+
+	if err := json.Unmarshal(v[1], &p); err != nil || p.Bucket == "" || p.Key == "" {
+		return p, false
+	}
+
+	return p, true
+}
+
+// An Option customizes an Offloader
+type Option func(*Offloader)
+
+// WithThreshold sets the message size in bytes above which message bodies are
+// offloaded, by default ocaws.MaxMessageSize
+func WithThreshold(n int) Option {
+	return Option(func(o *Offloader) {
+		o.threshold = n
+	})
+}
+
+// WithKeyFunc sets the function used to generate S3 object keys, by default
+// keys are random
+func WithKeyFunc(fn func() string) Option {
+	return Option(func(o *Offloader) {
+		o.key = func() (string, error) {
+			return fn(), nil
+		}
+	})
+}
+
+// An Offloader stores message bodies in an S3 bucket
+type Offloader struct {
+	client    s3iface.S3API
+	bucket    string
+	threshold int
+	key       func() (string, error)
+}
+
+// New constructs a new Offloader storing message bodies in the given bucket.
+// Use Option functions to customise configuration.
+func New(client s3iface.S3API, bucket string, opts ...Option) *Offloader {
+	o := &Offloader{
+		client:    client,
+		bucket:    bucket,
+		threshold: ocaws.MaxMessageSize,
+		key:       randomKey,
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// ShouldOffload returns true if a message of the given size, including its
+// message attributes, should have its body offloaded
+func (o *Offloader) ShouldOffload(size int) bool {
+	return size > o.threshold
+}
+
+// Put stores the body in S3 returning a pointer to use as the message body.
+// A client span is started as a child of the span in the context. An error is
+// returned if a key cannot be generated for the object.
+func (o *Offloader) Put(ctx context.Context, body string) (string, error) {
+	key, err := o.key()
+	if err != nil {
+		return "", err
+	}
+
+	p := Pointer{
+		Bucket: o.bucket,
+		Key:    key,
+	}
+
+	ctx, span := startSpan(ctx, PutObjectSpanName, p)
+	defer span.End()
+
+	span.AddAttributes(trace.Int64Attribute(SizeSpanAttribute, int64(len(body))))
+
+	_, err = o.client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(p.Bucket),
+		Key:    aws.String(p.Key),
+		Body:   strings.NewReader(body),
+	})
+	if err != nil {
+		span.SetStatus(ocaws.TraceStatus(err))
+		return "", err
+	}
+
+	return p.String(), nil
+}
+
+// Offload stores the body in S3 if a message of the given size should have
+// its body offloaded, returning the pointer to use as the message body and a
+// copy of the message attributes with the SizeAttribute added. The size should
+// include any span context message attributes which will be added, these are
+// added once the body has been offloaded if there is still room.
+// ErrTooManyAttributes is returned if the message attributes leave no room for
+// the SizeAttribute.
+func (o *Offloader) Offload(ctx context.Context, body *string, attrs ocaws.MessageAttributes, size int) (*string, ocaws.MessageAttributes, error) {
+	if body == nil || !o.ShouldOffload(size) {
+		return body, attrs, nil
+	}
+
+	sizeAttrs := ocaws.MessageAttributes{
+		SizeAttribute: ocaws.NumberAttribute(int64(len(*body))),
+	}
+
+	if !attrs.Fits(sizeAttrs) {
+		return body, attrs, ErrTooManyAttributes
+	}
+
+	ptr, err := o.Put(ctx, *body)
+	if err != nil {
+		return body, attrs, err
+	}
+
+	attrs = attrs.Copy()
+	if attrs == nil {
+		attrs = make(ocaws.MessageAttributes)
+	}
+
+	attrs.Merge(sizeAttrs)
+
+	return aws.String(ptr), attrs, nil
+}
+
+// Get returns the message body from S3 if the body is a pointer, otherwise
+// the body is returned as is. A client span is started as a child of the span
+// in the context when fetching the body.
+func (o *Offloader) Get(ctx context.Context, body string) (string, error) {
+	p, ok := ParsePointer(body)
+	if !ok {
+		return body, nil
+	}
+
+	ctx, span := startSpan(ctx, GetObjectSpanName, p)
+	defer span.End()
+
+	out, err := o.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(p.Bucket),
+		Key:    aws.String(p.Key),
+	})
+	if err != nil {
+		span.SetStatus(ocaws.TraceStatus(err))
+		return "", err
+	}
+	defer out.Body.Close()
+
+	b, err := ioutil.ReadAll(out.Body)
+	if err != nil {
+		span.SetStatus(ocaws.TraceStatus(err))
+		return "", err
+	}
+
+	span.AddAttributes(trace.Int64Attribute(SizeSpanAttribute, int64(len(b))))
+
+	return string(b), nil
+}
+
+// startSpan starts a client span for a call to S3
+func startSpan(ctx context.Context, name string, p Pointer) (context.Context, *trace.Span) {
+	ctx, span := trace.StartSpan(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	span.AddAttributes(
+		trace.StringAttribute(BucketAttribute, p.Bucket),
+		trace.StringAttribute(KeyAttribute, p.Key))
+
+	return ctx, span
+}
+
+// randomKey returns a random object key, an error is returned if random
+// bytes cannot be read
+func randomKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
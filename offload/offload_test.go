@@ -0,0 +1,325 @@
+package offload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.krak3n.codes/ocaws"
+	"go.krak3n.codes/ocaws/ocawstest"
+	"go.opencensus.io/trace"
+)
+
+var exporter = &ocawstest.TestExporter{}
+
+type TestS3 struct {
+	s3iface.S3API
+
+	PutObjectWithContextFunc func(aws.Context, *s3.PutObjectInput, ...request.Option) (*s3.PutObjectOutput, error)
+	GetObjectWithContextFunc func(aws.Context, *s3.GetObjectInput, ...request.Option) (*s3.GetObjectOutput, error)
+}
+
+func (s *TestS3) PutObjectWithContext(ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	return s.PutObjectWithContextFunc(ctx, in, opts...)
+}
+
+func (s *TestS3) GetObjectWithContext(ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	return s.GetObjectWithContextFunc(ctx, in, opts...)
+}
+
+func TestMain(m *testing.M) {
+	trace.ApplyConfig(trace.Config{
+		IDGenerator: ocawstest.NewTestIDGenerator(),
+	})
+
+	trace.RegisterExporter(exporter)
+
+	os.Exit(m.Run())
+}
+
+func TestParsePointer(t *testing.T) {
+	type TestCase struct {
+		tName   string
+		body    string
+		pointer Pointer
+		ok      bool
+	}
+	tt := []TestCase{
+		{
+			tName:   "pointer",
+			body:    `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"foo","s3Key":"bar"}]`,
+			pointer: Pointer{Bucket: "foo", Key: "bar"},
+			ok:      true,
+		},
+		{
+			tName:   "legacy pointer",
+			body:    `["com.amazon.sqs.javamessaging.MessageS3Pointer",{"s3BucketName":"foo","s3Key":"bar"}]`,
+			pointer: Pointer{Bucket: "foo", Key: "bar"},
+			ok:      true,
+		},
+		{
+			tName: "not json",
+			body:  "foo",
+		},
+		{
+			tName: "json array",
+			body:  `["foo","bar"]`,
+		},
+		{
+			tName: "unknown class",
+			body:  `["foo",{"s3BucketName":"foo","s3Key":"bar"}]`,
+		},
+		{
+			tName: "missing key",
+			body:  `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"foo"}]`,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			p, ok := ParsePointer(tc.body)
+			assert.Equal(t, tc.ok, ok)
+
+			if tc.ok {
+				assert.Equal(t, tc.pointer, p)
+			}
+		})
+	}
+}
+
+func TestPointer_String(t *testing.T) {
+	p := Pointer{Bucket: "foo", Key: "bar"}
+
+	assert.Equal(t, `["software.amazon.payloadoffloading.PayloadS3Pointer",{"s3BucketName":"foo","s3Key":"bar"}]`, p.String())
+
+	parsed, ok := ParsePointer(p.String())
+	require.True(t, ok)
+	assert.Equal(t, p, parsed)
+}
+
+func TestOffloader_ShouldOffload(t *testing.T) {
+	o := New(&TestS3{}, "foo", WithThreshold(10))
+
+	assert.False(t, o.ShouldOffload(10))
+	assert.True(t, o.ShouldOffload(11))
+}
+
+func TestOffloader_Put(t *testing.T) {
+	client := &TestS3{
+		PutObjectWithContextFunc: func(ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+			assert.NotNil(t, trace.FromContext(ctx))
+			assert.Equal(t, "foo", aws.StringValue(in.Bucket))
+			assert.Equal(t, "bar", aws.StringValue(in.Key))
+
+			b, err := ioutil.ReadAll(in.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "baz", string(b))
+
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	o := New(client, "foo", WithKeyFunc(func() string { return "bar" }))
+
+	ctx, span := trace.StartSpan(context.Background(), t.Name(), trace.WithSampler(trace.AlwaysSample()))
+
+	body, err := o.Put(ctx, "baz")
+	require.NoError(t, err)
+	assert.Equal(t, Pointer{Bucket: "foo", Key: "bar"}.String(), body)
+
+	span.End()
+
+	sd, ok := exporter.Span(PutObjectSpanName)
+	require.True(t, ok)
+	assert.Equal(t, span.SpanContext().SpanID, sd.ParentSpanID)
+	assert.Equal(t, trace.SpanKindClient, sd.SpanKind)
+	assert.Equal(t, "foo", sd.Attributes[BucketAttribute])
+	assert.Equal(t, "bar", sd.Attributes[KeyAttribute])
+	assert.Equal(t, int64(3), sd.Attributes[SizeSpanAttribute])
+}
+
+func TestOffloader_Put_error(t *testing.T) {
+	client := &TestS3{
+		PutObjectWithContextFunc: func(ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+			return nil, errors.New("boom")
+		},
+	}
+
+	o := New(client, "foo")
+
+	ctx, span := trace.StartSpan(context.Background(), t.Name(), trace.WithSampler(trace.AlwaysSample()))
+
+	_, err := o.Put(ctx, "baz")
+	assert.EqualError(t, err, "boom")
+
+	span.End()
+
+	sd, ok := exporter.Span(PutObjectSpanName)
+	require.True(t, ok)
+	assert.Equal(t, int32(trace.StatusCodeUnknown), sd.Status.Code)
+}
+
+func TestOffloader_Put_keyError(t *testing.T) {
+	o := New(&TestS3{}, "foo")
+	o.key = func() (string, error) {
+		return "", errors.New("boom")
+	}
+
+	_, err := o.Put(context.Background(), "baz")
+	assert.EqualError(t, err, "boom")
+}
+
+func TestOffloader_Offload(t *testing.T) {
+	attrs := func(n int) ocaws.MessageAttributes {
+		attrs := make(ocaws.MessageAttributes, n)
+		for i := 0; i < n; i++ {
+			attrs[fmt.Sprintf("Attr%d", i)] = ocaws.StringAttribute("foo")
+		}
+
+		return attrs
+	}
+
+	type TestCase struct {
+		tName string
+		size  int
+		attrs ocaws.MessageAttributes
+		body  string
+		err   error
+		put   bool
+	}
+	tt := []TestCase{
+		{
+			tName: "small message",
+			size:  10,
+			body:  "baz",
+		},
+		{
+			tName: "large message",
+			size:  11,
+			body:  Pointer{Bucket: "foo", Key: "bar"}.String(),
+			put:   true,
+		},
+		{
+			tName: "room for the size attribute",
+			size:  11,
+			attrs: attrs(ocaws.MaxMessageAttributes - 1),
+			body:  Pointer{Bucket: "foo", Key: "bar"}.String(),
+			put:   true,
+		},
+		{
+			tName: "message attribute limit",
+			size:  11,
+			attrs: attrs(ocaws.MaxMessageAttributes),
+			body:  "baz",
+			err:   ErrTooManyAttributes,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			var put bool
+
+			client := &TestS3{
+				PutObjectWithContextFunc: func(ctx aws.Context, in *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+					put = true
+					return &s3.PutObjectOutput{}, nil
+				},
+			}
+
+			o := New(client, "foo", WithThreshold(10), WithKeyFunc(func() string { return "bar" }))
+
+			n := len(tc.attrs)
+
+			body, attrs, err := o.Offload(context.Background(), aws.String("baz"), tc.attrs, tc.size)
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.put, put)
+			assert.Equal(t, tc.body, aws.StringValue(body))
+			assert.Len(t, tc.attrs, n, "attributes not copied")
+
+			if tc.put {
+				assert.Len(t, attrs, n+1)
+				assert.Equal(t, ocaws.NumberAttribute(3), attrs[SizeAttribute])
+			} else {
+				assert.Equal(t, tc.attrs, attrs)
+			}
+		})
+	}
+}
+
+func TestOffloader_Get(t *testing.T) {
+	type TestCase struct {
+		tName string
+		body  string
+		calls int
+	}
+	tt := []TestCase{
+		{
+			tName: "pointer",
+			body:  Pointer{Bucket: "foo", Key: "bar"}.String(),
+			calls: 1,
+		},
+		{
+			tName: "not a pointer",
+			body:  "baz",
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			var calls int
+
+			client := &TestS3{
+				GetObjectWithContextFunc: func(ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+					assert.NotNil(t, trace.FromContext(ctx))
+					assert.Equal(t, "foo", aws.StringValue(in.Bucket))
+					assert.Equal(t, "bar", aws.StringValue(in.Key))
+
+					calls++
+
+					return &s3.GetObjectOutput{
+						Body: ioutil.NopCloser(strings.NewReader("baz")),
+					}, nil
+				},
+			}
+
+			o := New(client, "foo")
+
+			ctx, span := trace.StartSpan(context.Background(), t.Name(), trace.WithSampler(trace.AlwaysSample()))
+			defer span.End()
+
+			body, err := o.Get(ctx, tc.body)
+			require.NoError(t, err)
+			assert.Equal(t, "baz", body)
+			assert.Equal(t, tc.calls, calls)
+		})
+	}
+}
+
+func TestOffloader_Get_error(t *testing.T) {
+	client := &TestS3{
+		GetObjectWithContextFunc: func(ctx aws.Context, in *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+			return nil, errors.New("boom")
+		},
+	}
+
+	o := New(client, "foo")
+
+	_, err := o.Get(context.Background(), Pointer{Bucket: "foo", Key: "bar"}.String())
+	assert.EqualError(t, err, "boom")
+}
@@ -0,0 +1,91 @@
+package b3
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opencensus.io/plugin/ochttp/propagation/b3"
+	"go.opencensus.io/trace"
+)
+
+// SingleKey is the message attribute key used by the SinglePropagator
+const SingleKey = "B3"
+
+// SinglePropagator implements the Propagator interface using the B3 single
+// header format, {TraceId}-{SpanId}-{SamplingState}, to propagate span contexts
+// in a single message attribute. This is useful for messages which are close
+// to the message attribute limit.
+type SinglePropagator struct{}
+
+// NewSingle constructs a new B3 single attribute based propagator
+func NewSingle() *SinglePropagator {
+	return &SinglePropagator{}
+}
+
+// SpanContextToMessageAttributes takes a trace.SpanContext and adds a single
+// attribute to a given SQS / SNS message
+func (p *SinglePropagator) SpanContextToMessageAttributes(sc trace.SpanContext, t interface{}) bool {
+	sampled := "0"
+	if sc.IsSampled() {
+		sampled = "1"
+	}
+
+	v := strings.Join([]string{sc.TraceID.String(), sc.SpanID.String(), sampled}, "-")
+
+	switch T := t.(type) {
+	case map[string]*sqs.MessageAttributeValue:
+		T[SingleKey] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(v),
+		}
+	case map[string]*sns.MessageAttributeValue:
+		T[SingleKey] = &sns.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(v),
+		}
+	default:
+		return false
+	}
+
+	return true
+}
+
+// SpanContextFromMessageAttributes returns a trace.SpanContext from a single
+// B3 message attribute on a SQS / SNS message
+func (p *SinglePropagator) SpanContextFromMessageAttributes(v interface{}) (trace.SpanContext, bool) {
+	kv := MessageAttributeValueToAttributes(v)
+
+	value, ok := kv[SingleKey]
+	if !ok {
+		return trace.SpanContext{}, false
+	}
+
+	// The sampling state and parent span id are optional
+	parts := strings.Split(value, "-")
+	if len(parts) < 2 {
+		return trace.SpanContext{}, false
+	}
+
+	tid, ok := b3.ParseTraceID(parts[0])
+	if !ok {
+		return trace.SpanContext{}, false
+	}
+
+	sid, ok := b3.ParseSpanID(parts[1])
+	if !ok {
+		return trace.SpanContext{}, false
+	}
+
+	var sampled trace.TraceOptions
+	if len(parts) > 2 {
+		sampled, _ = b3.ParseSampled(parts[2])
+	}
+
+	return trace.SpanContext{
+		TraceID:      tid,
+		SpanID:       sid,
+		TraceOptions: sampled,
+	}, true
+}
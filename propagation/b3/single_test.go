@@ -0,0 +1,141 @@
+package b3
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"go.krak3n.codes/ocaws/ocawstest"
+	"go.opencensus.io/trace"
+)
+
+func TestSinglePropagator_SpanContextToMessageAttributes(t *testing.T) {
+	type TestCase struct {
+		tName    string
+		sc       trace.SpanContext
+		in       interface{}
+		expected interface{}
+		ok       bool
+	}
+	tt := []TestCase{
+		{
+			tName:    "invalid type",
+			in:       map[string]string{},
+			expected: map[string]string{},
+			ok:       false,
+		},
+		{
+			tName: "sns sampled",
+			sc: trace.SpanContext{
+				TraceID:      ocawstest.DefaultTraceID,
+				SpanID:       ocawstest.DefaultSpanID,
+				TraceOptions: trace.TraceOptions(1),
+			},
+			in: map[string]*sns.MessageAttributeValue{},
+			expected: map[string]*sns.MessageAttributeValue{
+				SingleKey: &sns.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String(ocawstest.DefaultTraceID.String() + "-" + ocawstest.DefaultSpanID.String() + "-1"),
+				},
+			},
+			ok: true,
+		},
+		{
+			tName: "sqs not sampled",
+			sc: trace.SpanContext{
+				TraceID:      ocawstest.DefaultTraceID,
+				SpanID:       ocawstest.DefaultSpanID,
+				TraceOptions: trace.TraceOptions(0),
+			},
+			in: map[string]*sqs.MessageAttributeValue{},
+			expected: map[string]*sqs.MessageAttributeValue{
+				SingleKey: &sqs.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String(ocawstest.DefaultTraceID.String() + "-" + ocawstest.DefaultSpanID.String() + "-0"),
+				},
+			},
+			ok: true,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			p := NewSingle()
+			ok := p.SpanContextToMessageAttributes(tc.sc, tc.in)
+
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expected, tc.in)
+		})
+	}
+}
+
+func TestSinglePropagator_SpanContextFromMessageAttributes(t *testing.T) {
+	attr := func(v string) map[string]*sqs.MessageAttributeValue {
+		return map[string]*sqs.MessageAttributeValue{
+			SingleKey: &sqs.MessageAttributeValue{
+				DataType:    aws.String("String"),
+				StringValue: aws.String(v),
+			},
+		}
+	}
+
+	type TestCase struct {
+		tName string
+		in    interface{}
+		sc    trace.SpanContext
+		ok    bool
+	}
+	tt := []TestCase{
+		{
+			tName: "no attribute",
+			in:    map[string]*sqs.MessageAttributeValue{},
+		},
+		{
+			tName: "no span ID",
+			in:    attr(ocawstest.DefaultTraceID.String()),
+		},
+		{
+			tName: "invalid trace ID",
+			in:    attr("invalid-" + ocawstest.DefaultSpanID.String()),
+		},
+		{
+			tName: "invalid span ID",
+			in:    attr(ocawstest.DefaultTraceID.String() + "-invalid"),
+		},
+		{
+			tName: "no sampling state",
+			in:    attr(ocawstest.DefaultTraceID.String() + "-" + ocawstest.DefaultSpanID.String()),
+			sc: trace.SpanContext{
+				TraceID: ocawstest.DefaultTraceID,
+				SpanID:  ocawstest.DefaultSpanID,
+			},
+			ok: true,
+		},
+		{
+			tName: "sampled",
+			in:    attr(ocawstest.DefaultTraceID.String() + "-" + ocawstest.DefaultSpanID.String() + "-1"),
+			sc: trace.SpanContext{
+				TraceID:      ocawstest.DefaultTraceID,
+				SpanID:       ocawstest.DefaultSpanID,
+				TraceOptions: trace.TraceOptions(1),
+			},
+			ok: true,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			p := NewSingle()
+			sc, ok := p.SpanContextFromMessageAttributes(tc.in)
+
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.sc, sc)
+		})
+	}
+}
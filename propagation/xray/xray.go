@@ -0,0 +1,143 @@
+package xray // import "go.krak3n.codes/ocaws/propagation/xray"
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opencensus.io/trace"
+)
+
+// TraceHeaderKey is the SQS message system attribute key for the AWS X-Ray
+// trace header
+const TraceHeaderKey = sqs.MessageSystemAttributeNameAwstraceHeader
+
+// Trace header fields
+const (
+	rootKey    = "Root"
+	parentKey  = "Parent"
+	sampledKey = "Sampled"
+)
+
+// Propagator implements the Propagator interface using the AWS X-Ray trace
+// header format, Root=1-{epoch}-{id};Parent={span};Sampled={0|1}, to propagate
+// span contexts in the SQS AWSTraceHeader message system attribute. The
+// OpenCensus trace id is split into the X-Ray epoch and id, so trace ids are
+// only valid for the X-Ray service if generated in the X-Ray format.
+type Propagator struct{}
+
+// New constructs a new X-Ray trace header based propagator
+func New() *Propagator {
+	return &Propagator{}
+}
+
+// SpanContextToMessageAttributes takes a trace.SpanContext and adds the trace
+// header to the SQS message system attributes
+func (p *Propagator) SpanContextToMessageAttributes(sc trace.SpanContext, t interface{}) bool {
+	v := TraceHeader(sc)
+
+	switch T := t.(type) {
+	case map[string]*sqs.MessageSystemAttributeValue:
+		T[TraceHeaderKey] = &sqs.MessageSystemAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(v),
+		}
+	case map[string]*string:
+		T[TraceHeaderKey] = aws.String(v)
+	default:
+		return false
+	}
+
+	return true
+}
+
+// SpanContextFromMessageAttributes returns a trace.SpanContext from the trace
+// header in SQS message system attributes, either those being sent or the
+// attributes of a received message
+func (p *Propagator) SpanContextFromMessageAttributes(v interface{}) (trace.SpanContext, bool) {
+	var header string
+
+	switch T := v.(type) {
+	case map[string]*sqs.MessageSystemAttributeValue:
+		if v, ok := T[TraceHeaderKey]; ok && v != nil && v.StringValue != nil {
+			header = *v.StringValue
+		}
+	case map[string]*string:
+		if v, ok := T[TraceHeaderKey]; ok && v != nil {
+			header = *v
+		}
+	}
+
+	if header == "" {
+		return trace.SpanContext{}, false
+	}
+
+	return ParseTraceHeader(header)
+}
+
+// TraceHeader formats a span context as an X-Ray trace header
+func TraceHeader(sc trace.SpanContext) string {
+	sampled := "0"
+	if sc.IsSampled() {
+		sampled = "1"
+	}
+
+	tid := sc.TraceID.String()
+
+	return fmt.Sprintf("%s=1-%s-%s;%s=%s;%s=%s",
+		rootKey, tid[:8], tid[8:],
+		parentKey, sc.SpanID.String(),
+		sampledKey, sampled)
+}
+
+// ParseTraceHeader parses a span context from an X-Ray trace header, the
+// header must contain both a root and parent
+func ParseTraceHeader(header string) (trace.SpanContext, bool) {
+	var (
+		sc               trace.SpanContext
+		hasRoot, hasSpan bool
+	)
+
+	for _, part := range strings.Split(header, ";") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case rootKey:
+			root := strings.Split(kv[1], "-")
+			if len(root) != 3 || root[0] != "1" {
+				return trace.SpanContext{}, false
+			}
+
+			b, err := hex.DecodeString(root[1] + root[2])
+			if err != nil || len(b) != len(sc.TraceID) {
+				return trace.SpanContext{}, false
+			}
+
+			copy(sc.TraceID[:], b)
+			hasRoot = true
+		case parentKey:
+			b, err := hex.DecodeString(kv[1])
+			if err != nil || len(b) != len(sc.SpanID) {
+				return trace.SpanContext{}, false
+			}
+
+			copy(sc.SpanID[:], b)
+			hasSpan = true
+		case sampledKey:
+			if kv[1] == "1" {
+				sc.TraceOptions = trace.TraceOptions(1)
+			}
+		}
+	}
+
+	if !hasRoot || !hasSpan {
+		return trace.SpanContext{}, false
+	}
+
+	return sc, true
+}
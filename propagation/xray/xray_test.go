@@ -0,0 +1,140 @@
+package xray
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"go.krak3n.codes/ocaws/ocawstest"
+	"go.opencensus.io/trace"
+)
+
+// header is the trace header for the default test trace and span ids
+const header = "Root=1-61626364-6566676869676b6c6d6e6f71;Parent=6162636465666768;Sampled=1"
+
+func TestSpanContextToMessageAttributes(t *testing.T) {
+	sc := trace.SpanContext{
+		TraceID:      ocawstest.DefaultTraceID,
+		SpanID:       ocawstest.DefaultSpanID,
+		TraceOptions: trace.TraceOptions(1),
+	}
+
+	type TestCase struct {
+		tName    string
+		in       interface{}
+		expected interface{}
+		ok       bool
+	}
+	tt := []TestCase{
+		{
+			tName:    "invalid type",
+			in:       map[string]*sqs.MessageAttributeValue{},
+			expected: map[string]*sqs.MessageAttributeValue{},
+		},
+		{
+			tName: "system attributes",
+			in:    map[string]*sqs.MessageSystemAttributeValue{},
+			expected: map[string]*sqs.MessageSystemAttributeValue{
+				TraceHeaderKey: &sqs.MessageSystemAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String(header),
+				},
+			},
+			ok: true,
+		},
+		{
+			tName: "message attributes",
+			in:    map[string]*string{},
+			expected: map[string]*string{
+				TraceHeaderKey: aws.String(header),
+			},
+			ok: true,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			ok := New().SpanContextToMessageAttributes(sc, tc.in)
+
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.expected, tc.in)
+		})
+	}
+}
+
+func TestSpanContextFromMessageAttributes(t *testing.T) {
+	type TestCase struct {
+		tName string
+		in    interface{}
+		sc    trace.SpanContext
+		ok    bool
+	}
+	tt := []TestCase{
+		{
+			tName: "invalid type",
+			in:    map[string]string{},
+		},
+		{
+			tName: "no header",
+			in:    map[string]*string{},
+		},
+		{
+			tName: "invalid root",
+			in: map[string]*string{
+				TraceHeaderKey: aws.String("Root=foo;Parent=6162636465666768"),
+			},
+		},
+		{
+			tName: "invalid parent",
+			in: map[string]*string{
+				TraceHeaderKey: aws.String("Root=1-61626364-6566676869676b6c6d6e6f71;Parent=foo"),
+			},
+		},
+		{
+			tName: "no parent",
+			in: map[string]*string{
+				TraceHeaderKey: aws.String("Root=1-61626364-6566676869676b6c6d6e6f71"),
+			},
+		},
+		{
+			tName: "message attributes",
+			in: map[string]*string{
+				TraceHeaderKey: aws.String(header),
+			},
+			sc: trace.SpanContext{
+				TraceID:      ocawstest.DefaultTraceID,
+				SpanID:       ocawstest.DefaultSpanID,
+				TraceOptions: trace.TraceOptions(1),
+			},
+			ok: true,
+		},
+		{
+			tName: "system attributes not sampled",
+			in: map[string]*sqs.MessageSystemAttributeValue{
+				TraceHeaderKey: &sqs.MessageSystemAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String("Root=1-61626364-6566676869676b6c6d6e6f71;Parent=6162636465666768;Sampled=0"),
+				},
+			},
+			sc: trace.SpanContext{
+				TraceID: ocawstest.DefaultTraceID,
+				SpanID:  ocawstest.DefaultSpanID,
+			},
+			ok: true,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			sc, ok := New().SpanContextFromMessageAttributes(tc.in)
+
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.sc, sc)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package ocaws
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opencensus.io/trace"
+)
+
+// MaxMessageSize is the maximum size in bytes of a message SQS and SNS accept,
+// including the message body and message attributes
+const MaxMessageSize = 262144
+
+// An OversizePolicy defines what happens when adding span context message
+// attributes to a message would exceed MaxMessageSize
+type OversizePolicy int
+
+// Oversize policies
+const (
+	// SendOversize sends the message as is, SQS or SNS will reject it
+	SendOversize OversizePolicy = iota
+
+	// DropTraceAttributes removes the span context message attributes from
+	// the message so it can be sent without propagating the span context
+	DropTraceAttributes
+
+	// RejectOversize returns a *MessageTooLargeError without sending the
+	// message
+	RejectOversize
+)
+
+// Apply records the size of the message on the span under the size attribute
+// and applies the policy if the message exceeds MaxMessageSize. The previous
+// attributes are the message attributes before span context was added, these
+// are returned if trace attributes are dropped. A *MessageTooLargeError is
+// returned if the message is rejected.
+func (p OversizePolicy) Apply(span *trace.Span, sizeAttribute string, body *string, attrs, prev MessageAttributes) (MessageAttributes, error) {
+	size := MessageSize(body, attrs)
+	span.AddAttributes(trace.Int64Attribute(sizeAttribute, int64(size)))
+
+	if size <= MaxMessageSize {
+		return attrs, nil
+	}
+
+	switch p {
+	case DropTraceAttributes:
+		span.Annotate([]trace.Attribute{
+			trace.Int64Attribute(sizeAttribute, int64(MessageSize(body, prev))),
+		}, "Span context not propagated: message size limit exceeded")
+
+		return prev, nil
+	case RejectOversize:
+		span.Annotate([]trace.Attribute{
+			trace.Int64Attribute(sizeAttribute, int64(size)),
+		}, "Message not sent: message size limit exceeded")
+
+		return attrs, &MessageTooLargeError{Size: size}
+	}
+
+	return attrs, nil
+}
+
+// A MessageTooLargeError is returned when a message exceeds MaxMessageSize
+// and the RejectOversize policy is used
+type MessageTooLargeError struct {
+	// Size is the size of the message in bytes including span context
+	// message attributes
+	Size int
+}
+
+// Error implements the error interface
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("ocaws: message size of %d bytes exceeds the maximum of %d bytes", e.Size, MaxMessageSize)
+}
+
+// MessageSize returns the size in bytes of a message as counted by SQS and
+// SNS, this is the size of the body plus the name, data type and value of each
+// message attribute. Attributes may be MessageAttributes or SQS or SNS message
+// attributes, other types are not counted.
+func MessageSize(body *string, attrs interface{}) int {
+	var size int
+	if body != nil {
+		size += len(*body)
+	}
+
+	switch attrs := attrs.(type) {
+	case MessageAttributes:
+		for k, v := range attrs {
+			size += messageAttributeSize(k, &v.DataType, v.StringValue, v.BinaryValue)
+		}
+	case map[string]*sqs.MessageAttributeValue:
+		for k, v := range attrs {
+			if v != nil {
+				size += messageAttributeSize(k, v.DataType, v.StringValue, v.BinaryValue)
+			}
+		}
+	case map[string]*sns.MessageAttributeValue:
+		for k, v := range attrs {
+			if v != nil {
+				size += messageAttributeSize(k, v.DataType, v.StringValue, v.BinaryValue)
+			}
+		}
+	}
+
+	return size
+}
+
+// messageAttributeSize returns the size of a single message attribute
+func messageAttributeSize(name string, dataType, str *string, bin []byte) int {
+	size := len(name) + len(bin)
+	if dataType != nil {
+		size += len(*dataType)
+	}
+
+	if str != nil {
+		size += len(*str)
+	}
+
+	return size
+}
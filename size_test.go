@@ -0,0 +1,134 @@
+package ocaws
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/trace"
+)
+
+func TestMessageSize(t *testing.T) {
+	type TestCase struct {
+		tName string
+		body  *string
+		attrs interface{}
+		size  int
+	}
+	tt := []TestCase{
+		{
+			tName: "nil",
+		},
+		{
+			tName: "body",
+			body:  aws.String("foo"),
+			size:  3,
+		},
+		{
+			tName: "message attributes",
+			body:  aws.String("foo"),
+			attrs: MessageAttributes{"Foo": StringAttribute("bar")},
+			size:  15,
+		},
+		{
+			tName: "sqs message attributes",
+			body:  aws.String("foo"),
+			attrs: map[string]*sqs.MessageAttributeValue{
+				"Foo": &sqs.MessageAttributeValue{
+					DataType:    aws.String("Binary"),
+					BinaryValue: []byte("bar"),
+				},
+			},
+			size: 15,
+		},
+		{
+			tName: "sns message attributes",
+			body:  aws.String("foo"),
+			attrs: map[string]*sns.MessageAttributeValue{
+				"Foo": &sns.MessageAttributeValue{
+					DataType:    aws.String("String"),
+					StringValue: aws.String("bar"),
+				},
+			},
+			size: 15,
+		},
+		{
+			tName: "unknown attributes",
+			body:  aws.String("foo"),
+			attrs: map[string]string{"Foo": "bar"},
+			size:  3,
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.size, MessageSize(tc.body, tc.attrs))
+		})
+	}
+}
+
+func TestOversizePolicy_Apply(t *testing.T) {
+	spanAttrs := MessageAttributes{"Trace": StringAttribute("foo")}
+
+	type TestCase struct {
+		tName  string
+		policy OversizePolicy
+		body   string
+		prev   MessageAttributes
+		attrs  MessageAttributes
+		err    error
+	}
+	tt := []TestCase{
+		{
+			tName:  "fits",
+			policy: RejectOversize,
+			body:   "foo",
+			attrs:  spanAttrs,
+		},
+		{
+			tName:  "send",
+			policy: SendOversize,
+			body:   strings.Repeat("a", MaxMessageSize),
+			attrs:  spanAttrs,
+		},
+		{
+			tName:  "drop trace attributes",
+			policy: DropTraceAttributes,
+			body:   strings.Repeat("a", MaxMessageSize),
+		},
+		{
+			tName:  "drop trace attributes keeps previous",
+			policy: DropTraceAttributes,
+			body:   strings.Repeat("a", MaxMessageSize),
+			prev:   MessageAttributes{"Foo": StringAttribute("bar")},
+			attrs:  MessageAttributes{"Foo": StringAttribute("bar")},
+		},
+		{
+			tName:  "reject",
+			policy: RejectOversize,
+			body:   strings.Repeat("a", MaxMessageSize),
+			attrs:  spanAttrs,
+			err:    &MessageTooLargeError{Size: MaxMessageSize + 14},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			_, span := trace.StartSpan(context.Background(), t.Name())
+			defer span.End()
+
+			attrs, err := tc.policy.Apply(span, "message_size", aws.String(tc.body), spanAttrs, tc.prev)
+
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.attrs, attrs)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package ocaws
+
+import (
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// KeyOutcome is the tag holding the outcome of an operation, either OutcomeOK
+// or OutcomeError
+var KeyOutcome = tag.MustNewKey("aws_outcome")
+
+// Outcome tag values
+const (
+	OutcomeOK    = "ok"
+	OutcomeError = "error"
+)
+
+// DefaultLatencyDistribution is the distribution of latencies in milliseconds
+// used by the latency views of ocsqs and ocsns
+var DefaultLatencyDistribution = view.Distribution(1, 2, 3, 4, 5, 6, 8, 10, 13, 16, 20, 25, 30, 40, 50, 65, 80, 100, 130, 160, 200, 250, 300, 400, 500, 650, 800, 1000, 2000, 5000, 10000, 20000, 50000, 100000)
+
+// Outcome returns the outcome tag value for an error
+func Outcome(err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+
+	return OutcomeOK
+}
@@ -0,0 +1,148 @@
+package ocaws
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opencensus.io/trace"
+)
+
+// codes maps AWS error codes returned by SQS and SNS to OpenCensus canonical
+// status codes
+var codes = map[string]int32{
+	request.CanceledErrorCode:                       trace.StatusCodeCancelled,
+	request.ErrCodeResponseTimeout:                  trace.StatusCodeDeadlineExceeded,
+	"RequestError":                                  trace.StatusCodeUnavailable,
+	request.ErrCodeSerialization:                    trace.StatusCodeInternal,
+	request.ParamMinValueErrCode:                    trace.StatusCodeInvalidArgument,
+	request.ParamMinLenErrCode:                      trace.StatusCodeInvalidArgument,
+	request.ParamMaxLenErrCode:                      trace.StatusCodeInvalidArgument,
+	request.ParamRequiredErrCode:                    trace.StatusCodeInvalidArgument,
+	"AccessDenied":                                  trace.StatusCodePermissionDenied,
+	"AccessDeniedException":                         trace.StatusCodePermissionDenied,
+	"ExpiredToken":                                  trace.StatusCodeUnauthenticated,
+	"ExpiredTokenException":                         trace.StatusCodeUnauthenticated,
+	"IncompleteSignature":                           trace.StatusCodeUnauthenticated,
+	"InvalidClientTokenId":                          trace.StatusCodeUnauthenticated,
+	"MissingAuthenticationToken":                    trace.StatusCodeUnauthenticated,
+	"SignatureDoesNotMatch":                         trace.StatusCodeUnauthenticated,
+	"UnrecognizedClientException":                   trace.StatusCodeUnauthenticated,
+	"Throttling":                                    trace.StatusCodeResourceExhausted,
+	"ThrottlingException":                           trace.StatusCodeResourceExhausted,
+	"RequestThrottled":                              trace.StatusCodeResourceExhausted,
+	"InternalFailure":                               trace.StatusCodeInternal,
+	"ServiceUnavailable":                            trace.StatusCodeUnavailable,
+	"InvalidParameterValue":                         trace.StatusCodeInvalidArgument,
+	"InvalidParameterCombination":                   trace.StatusCodeInvalidArgument,
+	"MissingParameter":                              trace.StatusCodeInvalidArgument,
+	"ValidationError":                               trace.StatusCodeInvalidArgument,
+	sqs.ErrCodeQueueDoesNotExist:                    trace.StatusCodeNotFound,
+	sqs.ErrCodeQueueDeletedRecently:                 trace.StatusCodeUnavailable,
+	sqs.ErrCodeQueueNameExists:                      trace.StatusCodeAlreadyExists,
+	sqs.ErrCodeOverLimit:                            trace.StatusCodeResourceExhausted,
+	sqs.ErrCodeReceiptHandleIsInvalid:               trace.StatusCodeInvalidArgument,
+	sqs.ErrCodeMessageNotInflight:                   trace.StatusCodeFailedPrecondition,
+	sqs.ErrCodeInvalidMessageContents:               trace.StatusCodeInvalidArgument,
+	sqs.ErrCodeInvalidAttributeName:                 trace.StatusCodeInvalidArgument,
+	sqs.ErrCodeInvalidIdFormat:                      trace.StatusCodeInvalidArgument,
+	sqs.ErrCodeUnsupportedOperation:                 trace.StatusCodeUnimplemented,
+	sqs.ErrCodePurgeQueueInProgress:                 trace.StatusCodeFailedPrecondition,
+	sqs.ErrCodeBatchRequestTooLong:                  trace.StatusCodeInvalidArgument,
+	sqs.ErrCodeEmptyBatchRequest:                    trace.StatusCodeInvalidArgument,
+	sqs.ErrCodeTooManyEntriesInBatchRequest:         trace.StatusCodeInvalidArgument,
+	sqs.ErrCodeBatchEntryIdsNotDistinct:             trace.StatusCodeInvalidArgument,
+	sqs.ErrCodeInvalidBatchEntryId:                  trace.StatusCodeInvalidArgument,
+	sns.ErrCodeNotFoundException:                    trace.StatusCodeNotFound,
+	sns.ErrCodeInvalidParameterException:            trace.StatusCodeInvalidArgument,
+	sns.ErrCodeInvalidParameterValueException:       trace.StatusCodeInvalidArgument,
+	sns.ErrCodeAuthorizationErrorException:          trace.StatusCodePermissionDenied,
+	sns.ErrCodeThrottledException:                   trace.StatusCodeResourceExhausted,
+	sns.ErrCodeInternalErrorException:               trace.StatusCodeInternal,
+	sns.ErrCodeEndpointDisabledException:            trace.StatusCodeFailedPrecondition,
+	sns.ErrCodePlatformApplicationDisabledException: trace.StatusCodeFailedPrecondition,
+	sns.ErrCodeKMSAccessDeniedException:             trace.StatusCodePermissionDenied,
+	sns.ErrCodeKMSDisabledException:                 trace.StatusCodeFailedPrecondition,
+	sns.ErrCodeKMSInvalidStateException:             trace.StatusCodeFailedPrecondition,
+	sns.ErrCodeKMSNotFoundException:                 trace.StatusCodeNotFound,
+	sns.ErrCodeKMSOptInRequired:                     trace.StatusCodeFailedPrecondition,
+	sns.ErrCodeKMSThrottlingException:               trace.StatusCodeResourceExhausted,
+}
+
+// TraceStatus returns a trace status for an error, errors returned by AWS
+// have their error codes mapped to OpenCensus canonical status codes. A nil
+// error returns an OK status.
+func TraceStatus(err error) trace.Status {
+	switch err {
+	case nil:
+		return trace.Status{Code: trace.StatusCodeOK}
+	case context.Canceled:
+		return trace.Status{Code: trace.StatusCodeCancelled, Message: err.Error()}
+	case context.DeadlineExceeded:
+		return trace.Status{Code: trace.StatusCodeDeadlineExceeded, Message: err.Error()}
+	}
+
+	switch err := err.(type) {
+	case *MessageTooLargeError:
+		return trace.Status{Code: trace.StatusCodeInvalidArgument, Message: err.Error()}
+	case awserr.Error:
+		return trace.Status{Code: awsCode(err), Message: err.Code() + ": " + err.Message()}
+	}
+
+	return trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()}
+}
+
+// awsCode returns the canonical status code for an AWS error, falling back to
+// the HTTP status code of the response if the error code is unknown
+func awsCode(err awserr.Error) int32 {
+	if code, ok := codes[err.Code()]; ok {
+		return code
+	}
+
+	// Cancelled requests wrap the context error
+	switch err.OrigErr() {
+	case context.Canceled:
+		return trace.StatusCodeCancelled
+	case context.DeadlineExceeded:
+		return trace.StatusCodeDeadlineExceeded
+	}
+
+	if rf, ok := err.(awserr.RequestFailure); ok {
+		return httpCode(rf.StatusCode())
+	}
+
+	return trace.StatusCodeUnknown
+}
+
+// httpCode maps an HTTP status code to a canonical status code
+func httpCode(code int) int32 {
+	switch code {
+	case http.StatusBadRequest:
+		return trace.StatusCodeInvalidArgument
+	case http.StatusUnauthorized:
+		return trace.StatusCodeUnauthenticated
+	case http.StatusForbidden:
+		return trace.StatusCodePermissionDenied
+	case http.StatusNotFound:
+		return trace.StatusCodeNotFound
+	case http.StatusConflict:
+		return trace.StatusCodeAborted
+	case http.StatusTooManyRequests:
+		return trace.StatusCodeResourceExhausted
+	case http.StatusNotImplemented:
+		return trace.StatusCodeUnimplemented
+	case http.StatusServiceUnavailable:
+		return trace.StatusCodeUnavailable
+	case http.StatusGatewayTimeout:
+		return trace.StatusCodeDeadlineExceeded
+	}
+
+	if code >= 500 {
+		return trace.StatusCodeInternal
+	}
+
+	return trace.StatusCodeUnknown
+}
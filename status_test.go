@@ -0,0 +1,108 @@
+package ocaws
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"go.opencensus.io/trace"
+)
+
+func TestTraceStatus(t *testing.T) {
+	type TestCase struct {
+		tName  string
+		err    error
+		status trace.Status
+	}
+	tt := []TestCase{
+		{
+			tName:  "nil",
+			status: trace.Status{Code: trace.StatusCodeOK},
+		},
+		{
+			tName: "error",
+			err:   errors.New("boom"),
+			status: trace.Status{
+				Code:    trace.StatusCodeUnknown,
+				Message: "boom",
+			},
+		},
+		{
+			tName: "context cancelled",
+			err:   context.Canceled,
+			status: trace.Status{
+				Code:    trace.StatusCodeCancelled,
+				Message: "context canceled",
+			},
+		},
+		{
+			tName: "context deadline exceeded",
+			err:   context.DeadlineExceeded,
+			status: trace.Status{
+				Code:    trace.StatusCodeDeadlineExceeded,
+				Message: "context deadline exceeded",
+			},
+		},
+		{
+			tName: "message too large",
+			err:   &MessageTooLargeError{Size: MaxMessageSize + 1},
+			status: trace.Status{
+				Code:    trace.StatusCodeInvalidArgument,
+				Message: "ocaws: message size of 262145 bytes exceeds the maximum of 262144 bytes",
+			},
+		},
+		{
+			tName: "aws error",
+			err:   awserr.New("Foo", "boom", nil),
+			status: trace.Status{
+				Code:    trace.StatusCodeUnknown,
+				Message: "Foo: boom",
+			},
+		},
+		{
+			tName: "aws error code",
+			err:   awserr.New(sqs.ErrCodeQueueDoesNotExist, "boom", nil),
+			status: trace.Status{
+				Code:    trace.StatusCodeNotFound,
+				Message: "AWS.SimpleQueueService.NonExistentQueue: boom",
+			},
+		},
+		{
+			tName: "aws request cancelled",
+			err:   awserr.New(request.CanceledErrorCode, "boom", context.Canceled),
+			status: trace.Status{
+				Code:    trace.StatusCodeCancelled,
+				Message: "RequestCanceled: boom",
+			},
+		},
+		{
+			tName: "aws wrapped context error",
+			err:   awserr.New("Foo", "boom", context.DeadlineExceeded),
+			status: trace.Status{
+				Code:    trace.StatusCodeDeadlineExceeded,
+				Message: "Foo: boom",
+			},
+		},
+		{
+			tName: "aws request failure",
+			err:   awserr.NewRequestFailure(awserr.New("Foo", "boom", nil), http.StatusServiceUnavailable, "id"),
+			status: trace.Status{
+				Code:    trace.StatusCodeUnavailable,
+				Message: "Foo: boom",
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.tName, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.status, TraceStatus(tc.err))
+		})
+	}
+}